@@ -1,95 +1,335 @@
 package boot
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"go-gin-gorm-example/infrastructure/breaker"
 	"go-gin-gorm-example/infrastructure/config"
 	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/infrastructure/idempotency"
+	"go-gin-gorm-example/infrastructure/lifecycle"
 	"go-gin-gorm-example/infrastructure/limiter"
-	"go-gin-gorm-example/infrastructure/listener"
 	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/infrastructure/metrics"
 	"go-gin-gorm-example/infrastructure/redis"
-	"go-gin-gorm-example/module/article"
-	"go-gin-gorm-example/module/health"
-	"go-gin-gorm-example/utils"
+	"go-gin-gorm-example/infrastructure/retry"
+	"go-gin-gorm-example/infrastructure/tracing"
 
 	redisThirdPartyLib "github.com/go-redis/redis"
 	log "github.com/sirupsen/logrus"
 )
 
 type HandlerSetup struct {
-	Limiter     *limiter.RateLimiter
-	HealthHttp  health.InterfaceHttp
-	ArticleHttp article.InterfaceHttp
+	// Lifecycle stop the components in order on shutdown, the http server register its own hook
+	Lifecycle *lifecycle.Manager
+	Limiter   *limiter.RateLimiter
+	// Modules is the modules enabled and set up, their routes are mounted by the router
+	Modules []Module
 }
 
-func MakeHandler() HandlerSetup {
+// Dependencies is the infrastructure shared by the modules and the admin commands, the modules
+// build their own repositories and services on it in their Setup. It doesn't start anything
+// listening for traffic.
+type Dependencies struct {
+	// Lifecycle close the connections of the dependencies, the modules append their own hooks
+	Lifecycle *lifecycle.Manager
+	// Modules is the modules enabled in the config, their migrations are applied with the database ones
+	Modules     []Module
+	DB          database.HandlerDatabase
+	RedisClient *redisThirdPartyLib.Client
+	RedisLib    redis.LibInterface
+	RedisState  *retry.State
+	// Breakers is the breakers of the infrastructure, like the one of redis
+	Breakers []*breaker.Breaker
+	// LocalCache is nil unless redis.localCache.enableLocalCache is set
+	LocalCache *redis.LayeredClient
+}
+
+// MakeDependencies wire the dependencies for the admin commands, the database and redis
+// must be reachable once the startup retries are exhausted. The stdout log sinks write
+// to stderr, stdout is kept for the output of the command like an export.
+func MakeDependencies() Dependencies {
+	return makeDependencies(false)
+}
+
+// makeDependencies wire the dependencies, with serving the server may start in degraded mode
+// when startup.degradedMode is set.
+func makeDependencies(serving bool) Dependencies {
 	//initiate config
-	config.Initialize()
+	if err := config.Initialize(); err != nil {
+		log.Fatalf("failed load config: %v", err)
+		os.Exit(1)
+	}
 
-	//initiate logger
-	logger.Init(config.Conf.LogFormat, config.Conf.LogLevel)
+	//initiate logger, the admin commands keep stdout for their output like an export
+	logConf := config.Conf
+	if !serving {
+		logConf = logger.WithoutStdout(logConf)
+	}
+	if err := logger.Init(logConf); err != nil {
+		log.Fatalf("failed initiate logger: %v", err)
+		os.Exit(1)
+	}
+
+	//the migrations of the modules are applied on connect
+	modules, err := enabledModules(config.Conf)
+	if err != nil {
+		log.Fatalf("failed load modules: %v", err)
+		os.Exit(1)
+	}
 
-	var err error
+	ctx := context.Background()
+	degraded := serving && config.Conf.Startup.DegradedMode
+	manager := lifecycle.NewManager()
+	hookTimeout := config.Conf.Shutdown.HookTimeout
+	//flush the log sinks after the other hooks logged
+	manager.Append(lifecycle.Hook{
+		Name:     "logger",
+		Priority: lifecycle.PriorityLogs,
+		Timeout:  hookTimeout,
+		OnStop: func(ctx context.Context) error {
+			return logger.Close()
+		},
+	})
 
-	//initiate a redis client
+	//initiate a redis client, reconnected in the background when it goes down
 	var redisClient *redisThirdPartyLib.Client
 	var redisLibInterface redis.LibInterface
+	var redisState *retry.State
+	var breakers []*breaker.Breaker
+	var localCache *redis.LayeredClient
 	if config.Conf.Redis.EnableRedis {
-		redisClient, err = redis.NewRedisClient(&config.Conf)
+		var reconnectingClient *redis.ReconnectingClient
+		redisClient, reconnectingClient, err = redis.Connect(ctx, &config.Conf, degraded)
 		if err != nil {
 			log.Fatalf("failed initiate redis: %v", err)
 			os.Exit(1)
 		}
-		//initiate a redis library interface
-		redisLibInterface, err = redis.NewRedisLibInterface(redisClient)
-		if err != nil {
-			log.Fatalf("failed initiate redis library: %v", err)
-			os.Exit(1)
+		redisLibInterface = reconnectingClient
+		redisState = reconnectingClient.State()
+		manager.Append(lifecycle.Hook{
+			Name:     "redis health check",
+			Priority: lifecycle.PriorityBackground,
+			Timeout:  hookTimeout,
+			OnStop: func(ctx context.Context) error {
+				reconnectingClient.Close()
+				return nil
+			},
+		})
+		manager.Append(lifecycle.Hook{
+			Name:     "redis",
+			Priority: lifecycle.PriorityClose,
+			Timeout:  hookTimeout,
+			OnStop: func(ctx context.Context) error {
+				return redisClient.Close()
+			},
+		})
+		//bypass the cache while redis is slow or failing
+		if config.Conf.CircuitBreaker.Redis.EnableCircuitBreaker {
+			redisBreaker := breaker.New("redis", config.Conf.CircuitBreaker.Redis, redis.IsFailure)
+			redisLibInterface = redis.NewBreakerClient(redisLibInterface, redisBreaker)
+			breakers = append(breakers, redisBreaker)
+		}
+		//put the in-process cache in front of redis when enabled
+		if config.Conf.Redis.LocalCache.EnableLocalCache {
+			localCache = redis.NewLayeredClient(redisClient, redisLibInterface, config.Conf.Redis.LocalCache)
+			redisLibInterface = localCache
+			manager.Append(lifecycle.Hook{
+				Name:     "local cache",
+				Priority: lifecycle.PriorityClose,
+				Timeout:  hookTimeout,
+				OnStop: func(ctx context.Context) error {
+					return localCache.Close()
+				},
+			})
 		}
 	}
 
-	//setup infrastructure postgres
+	//setup infrastructure database, postgres or sqlite
 	var db database.HandlerDatabase
-	if config.Conf.Postgres.EnablePostgres {
-		db, err = database.NewDatabaseClient(&config.Conf)
+	if config.Conf.DatabaseEnabled() {
+		db, err = database.Connect(ctx, &config.Conf, degraded, moduleMigrations(modules)...)
 		if err != nil {
-			log.Fatalf("failed initiate database postgres: %v", err)
+			log.Fatalf("failed initiate database %s: %v", config.Conf.DatabaseDriver(), err)
 			os.Exit(1)
 		}
+		manager.Append(lifecycle.Hook{
+			Name:     "database reconnect",
+			Priority: lifecycle.PriorityBackground,
+			Timeout:  hookTimeout,
+			OnStop: func(ctx context.Context) error {
+				db.StopReconnect()
+				return nil
+			},
+		})
+		manager.Append(lifecycle.Hook{
+			Name:     "database",
+			Priority: lifecycle.PriorityClose,
+			Timeout:  hookTimeout,
+			OnStop: func(ctx context.Context) error {
+				return db.Close()
+			},
+		})
 	}
 
+	return Dependencies{
+		Lifecycle:   manager,
+		Modules:     modules,
+		DB:          db,
+		RedisClient: redisClient,
+		RedisLib:    redisLibInterface,
+		RedisState:  redisState,
+		Breakers:    breakers,
+		LocalCache:  localCache,
+	}
+}
+
+func MakeHandler() HandlerSetup {
+	dependencies := makeDependencies(true)
+
 	//add limiter
-	interval := utils.StringUnitToDuration(config.Conf.Interval)
-	middlewareWithLimiter := limiter.NewRateLimiter(int(config.Conf.Rate), interval)
+	middlewareWithLimiter := limiter.NewRateLimiter(int(config.Conf.Rate), config.Conf.Interval)
+
+	//add idempotency store, shared on redis when enabled
+	var idempotencyStore idempotency.Store
+	if config.Conf.Idempotency.EnableIdempotency {
+		if config.Conf.Redis.EnableRedis {
+			idempotencyStore = idempotency.NewRedisStore(dependencies.RedisLib)
+		} else {
+			idempotencyStore = idempotency.NewInMemoryStore()
+		}
+	}
 
-	//health module
-	//article module
-	var articleRepository article.RepositoryInterface
-	var healthRepository health.RepositoryInterface
-	if config.Conf.Postgres.EnablePostgres {
-		articleRepository = article.NewRepository(db.DbConn)
-		healthRepository = health.NewRepository(db.DbConn)
-	} else {
-		articleRepository = article.NewInMemoryRepositoryRepositoryAdapter()
+	//initiate tracing, the spans not exported yet are flushed on shutdown
+	if err := initTracing(dependencies); err != nil {
+		log.Fatalf("failed initiate tracing: %v", err)
+		os.Exit(1)
 	}
 
-	healthService := health.NewService(healthRepository, redisClient)
-	healthModule := health.NewHttp(healthService)
+	//time the queries and export the pools
+	if config.Conf.Metrics.EnableMetrics {
+		if err := registerMetrics(dependencies); err != nil {
+			log.Fatalf("failed register metrics: %v", err)
+			os.Exit(1)
+		}
+	}
 
-	articleService := article.NewService(articleRepository, redisLibInterface)
-	articleModule := article.NewHttp(articleService)
+	//apply the config changes without restart, on a change of the config file or on SIGHUP
+	subscribeConfigReload(dependencies, middlewareWithLimiter)
+	stopWatch := config.Watch()
+	stopHangup := reloadConfigOnHangup()
+	dependencies.Lifecycle.Append(lifecycle.Hook{
+		Name:     "config reload",
+		Priority: lifecycle.PriorityBackground,
+		Timeout:  config.Conf.Shutdown.HookTimeout,
+		OnStop: func(ctx context.Context) error {
+			stopWatch()
+			stopHangup()
+			return nil
+		},
+	})
 
-	// add listener instance
-	listen := listener.NewListener(articleModule)
-	//add for trigger start up
-	listen.TriggerStartUp()
-	//add listen for shutdown event
-	listen.ListenForShutdownEvent()
+	//set up the modules, in the order of their requirements
+	moduleCtx := &ModuleContext{
+		Dependencies: dependencies,
+		Limiter:      middlewareWithLimiter,
+		Idempotency:  idempotencyStore,
+	}
+	for _, module := range dependencies.Modules {
+		if module.Setup == nil {
+			continue
+		}
+		if err := module.Setup(moduleCtx); err != nil {
+			log.Fatalf("failed setup module %s: %v", module.Name, err)
+			os.Exit(1)
+		}
+	}
 
 	return HandlerSetup{
-		Limiter:     middlewareWithLimiter,
-		HealthHttp:  healthModule,
-		ArticleHttp: articleModule,
+		Lifecycle: dependencies.Lifecycle,
+		Limiter:   middlewareWithLimiter,
+		Modules:   dependencies.Modules,
+	}
+}
+
+// subscribeConfigReload apply the reloadable settings to the dependencies and the limiter.
+func subscribeConfigReload(dependencies Dependencies, rateLimiter *limiter.RateLimiter) {
+	config.Subscribe("log levels", func(conf config.Config) error {
+		return logger.SetLevels(conf.LogLevel, conf.LogLevelOverrides())
+	}, "logLevel", "logLevels")
+	config.Subscribe("rate limiter", func(conf config.Config) error {
+		rateLimiter.Update(int(conf.Rate), conf.Interval)
+		return nil
+	}, "rate", "interval")
+	if dependencies.LocalCache != nil {
+		config.Subscribe("local cache", func(conf config.Config) error {
+			dependencies.LocalCache.UpdatePrefixes(conf.Redis.LocalCache.Prefixes)
+			return nil
+		}, "redis.localCache.prefixes")
+	}
+}
+
+// reloadConfigOnHangup reload the config on every SIGHUP until stop is called.
+func reloadConfigOnHangup() (stop func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			_ = config.Reload()
+		}
+	}()
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			signal.Stop(hangup)
+			close(hangup)
+		})
+	}
+}
+
+// registerMetrics instrument the databases of dependencies.
+func registerMetrics(dependencies Dependencies) error {
+	if !config.Conf.DatabaseEnabled() {
+		return nil
+	}
+	if err := metrics.InstrumentDB("primary", dependencies.DB.DbConn); err != nil {
+		return err
+	}
+	for name, db := range dependencies.DB.Replicas.DBs() {
+		if err := metrics.InstrumentDB("replica "+name, db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initTracing install the tracer provider and trace the queries of the databases of dependencies.
+func initTracing(dependencies Dependencies) error {
+	shutdown, err := tracing.Init(context.Background(), config.Conf.Tracing)
+	if err != nil {
+		return err
+	}
+	dependencies.Lifecycle.Append(lifecycle.Hook{
+		Name:     "tracing",
+		Priority: lifecycle.PriorityFlush,
+		Timeout:  config.Conf.Shutdown.HookTimeout,
+		OnStop:   shutdown,
+	})
+
+	if !config.Conf.Tracing.EnableTracing || !config.Conf.DatabaseEnabled() {
+		return nil
+	}
+	if err = tracing.InstrumentDB(dependencies.DB.DbConn); err != nil {
+		return err
+	}
+	for _, db := range dependencies.DB.Replicas.DBs() {
+		if err = tracing.InstrumentDB(db); err != nil {
+			return err
+		}
 	}
+	return nil
 }
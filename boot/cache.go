@@ -0,0 +1,45 @@
+package boot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-gin-gorm-example/infrastructure/config"
+	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/infrastructure/redis"
+)
+
+// FlushCache delete the keys of redis matching pattern, only redis is connected, not the database.
+// The local caches of the servers are invalidated too when redis.localCache is enabled.
+func FlushCache(ctx context.Context, pattern string) (int64, error) {
+	//initiate config
+	if err := config.Initialize(); err != nil {
+		return 0, fmt.Errorf("load config: %w", err)
+	}
+
+	//initiate logger, the count is printed on stdout and the logs go to stderr
+	if err := logger.Init(logger.WithoutStdout(config.Conf)); err != nil {
+		return 0, fmt.Errorf("initiate logger: %w", err)
+	}
+	defer logger.Close()
+
+	if !config.Conf.Redis.EnableRedis {
+		return 0, errors.New("redis is not enabled, there is no cache to flush")
+	}
+
+	redisClient, reconnectingClient, err := redis.Connect(ctx, &config.Conf, false)
+	if err != nil {
+		return 0, err
+	}
+	defer redisClient.Close()
+	defer reconnectingClient.Close()
+
+	var redisLib redis.LibInterface = reconnectingClient
+	if config.Conf.Redis.LocalCache.EnableLocalCache {
+		localCache := redis.NewLayeredClient(redisClient, redisLib, config.Conf.Redis.LocalCache)
+		defer localCache.Close()
+		redisLib = localCache
+	}
+	return redisLib.DeleteByPattern(ctx, pattern)
+}
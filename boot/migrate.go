@@ -0,0 +1,79 @@
+package boot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
+	logger "go-gin-gorm-example/infrastructure/log"
+)
+
+// RunMigration connect to the database (postgres or sqlite) and execute the migrate command
+// (up|down|status|to=N) without starting the http server.
+func RunMigration(command string) error {
+	//initiate config
+	if err := config.Initialize(); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	//initiate logger, the status is printed on stdout and the logs go to stderr
+	if err := logger.Init(logger.WithoutStdout(config.Conf)); err != nil {
+		return fmt.Errorf("initiate logger: %w", err)
+	}
+	defer logger.Close()
+
+	if !config.Conf.DatabaseEnabled() {
+		return errors.New("no database is enabled, there is nothing to migrate")
+	}
+
+	modules, err := enabledModules(config.Conf)
+	if err != nil {
+		return err
+	}
+
+	//the command decide which migration to run, not the boot setting
+	conf := config.Conf
+	conf.Postgres.AutoMigrate = false
+	conf.Database.SQLite.AutoMigrate = false
+	conf.Postgres.Replica.Hosts = nil
+	//a migration job started with the database wait for it like the server
+	db, err := database.Connect(context.Background(), &conf, false)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DbConn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	migrator, err := database.NewMigrator(db.DbConn, moduleMigrations(modules)...)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := migrator.Run(context.Background(), command)
+	if err != nil {
+		return err
+	}
+
+	if command == database.MigrateStatus {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package boot
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/idempotency"
+	"go-gin-gorm-example/infrastructure/limiter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Module is a feature of the server with its routes, lifecycle hooks and migrations. A module register
+// itself with RegisterModule from the init of its package, imported by main.go, so adding one doesn't
+// touch the boot or the router.
+type Module struct {
+	Name string
+	// Requires is the modules set up before this one, the boot fail when one of them is disabled
+	Requires []string
+	// Enabled turn the module off for conf, it is on when nil unless listed in modules.disabled
+	Enabled func(conf config.Config) bool
+	// Migrations is the sql migrations of the module, named like the ones of the migrations package,
+	// the versions are shared by every module
+	Migrations fs.FS
+	// Setup build the module before the server start, it can append hooks to ctx.Lifecycle
+	Setup func(ctx *ModuleContext) error
+	// Routes mount the routes of the module, once every module is set up
+	Routes func(routes Routes)
+}
+
+// ModuleContext is the dependencies the modules are set up with.
+type ModuleContext struct {
+	Dependencies
+	Limiter *limiter.RateLimiter
+	// Idempotency is nil unless idempotency.enableIdempotency is set
+	Idempotency idempotency.Store
+	// HealthCheckers is checked by the health module with the infrastructure ones, a module append
+	// the checkers of its own dependencies
+	HealthCheckers []HealthChecker
+}
+
+// HealthChecker check one dependency of the service, the service is not ready
+// while a critical dependency is down, it is only degraded for the others.
+type HealthChecker interface {
+	Name() string
+	Critical() bool
+	Check(ctx context.Context) error
+}
+
+// Routes is where the modules mount their routes.
+type Routes struct {
+	// Root is not rate limited, like the probes and the admin endpoints
+	Root *gin.RouterGroup
+	// V1 is /api/v1, rate limited
+	V1 *gin.RouterGroup
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   []Module
+)
+
+// RegisterModule add module to the server, it panic when a module of the same name is registered.
+func RegisterModule(module Module) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	for _, registered := range modules {
+		if registered.Name == module.Name {
+			panic("boot: module " + module.Name + " is registered twice")
+		}
+	}
+	modules = append(modules, module)
+}
+
+// enabledModules return the modules enabled in conf, a module come after the ones it requires
+// and in the order of registration otherwise.
+func enabledModules(conf config.Config) ([]Module, error) {
+	modulesMu.Lock()
+	registered := append([]Module(nil), modules...)
+	modulesMu.Unlock()
+
+	byName := make(map[string]Module, len(registered))
+	for _, module := range registered {
+		byName[module.Name] = module
+	}
+	disabled := make(map[string]bool, len(conf.Modules.Disabled))
+	for _, name := range conf.Modules.Disabled {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("modules.disabled: unknown module %q", name)
+		}
+		disabled[name] = true
+	}
+	enabled := func(module Module) bool {
+		return !disabled[module.Name] && (module.Enabled == nil || module.Enabled(conf))
+	}
+
+	var sorted []Module
+	visited := make(map[string]bool, len(registered))
+	var visit func(module Module, path []string) error
+	visit = func(module Module, path []string) error {
+		if visited[module.Name] {
+			return nil
+		}
+		for _, name := range path {
+			if name == module.Name {
+				return fmt.Errorf("modules require each other: %s", strings.Join(append(path, module.Name), " -> "))
+			}
+		}
+		for _, name := range module.Requires {
+			required, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("module %s requires %s, which is not registered", module.Name, name)
+			}
+			if !enabled(required) {
+				return fmt.Errorf("module %s requires %s, which is disabled", module.Name, name)
+			}
+			if err := visit(required, append(path, module.Name)); err != nil {
+				return err
+			}
+		}
+		visited[module.Name] = true
+		sorted = append(sorted, module)
+		return nil
+	}
+
+	for _, module := range registered {
+		if !enabled(module) {
+			continue
+		}
+		if err := visit(module, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// moduleMigrations return the sources of the migrations of modules, applied by the auto migration
+// and the migrate command.
+func moduleMigrations(modules []Module) []fs.FS {
+	var sources []fs.FS
+	for _, module := range modules {
+		if module.Migrations != nil {
+			sources = append(sources, module.Migrations)
+		}
+	}
+	return sources
+}
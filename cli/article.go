@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/httplib"
+	"go-gin-gorm-example/infrastructure/validator"
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/primitive"
+)
+
+const articleUsage = "usage: article create|list|delete [flags]"
+
+func runArticle(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(articleUsage)
+	}
+	switch args[0] {
+	case "create":
+		return runArticleCreate(ctx, args[1:])
+	case "list":
+		return runArticleList(ctx, args[1:])
+	case "delete":
+		return runArticleDelete(ctx, args[1:])
+	default:
+		return errors.New(articleUsage)
+	}
+}
+
+func runArticleCreate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("article create", flag.ContinueOnError)
+	var payload primitive.ArticleReq
+	flags.StringVar(&payload.Author, "author", "", "author of the article")
+	flags.StringVar(&payload.Title, "title", "", "title of the article")
+	flags.StringVar(&payload.Body, "body", "", "body of the article")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if errValidate := validator.ValidateStructResponseSliceString(payload); errValidate != nil {
+		return errors.New(strings.Join(errValidate, ", "))
+	}
+
+	return withArticles(ctx, true, func(articles article.Article) error {
+		data, err := articles.Service.RecordArticle(ctx, payload)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created article %d\n", data.ID)
+		return nil
+	})
+}
+
+func runArticleList(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("article list", flag.ContinueOnError)
+	page := flags.Int("page", 1, "page number")
+	size := flags.Int("size", 10, "page size")
+	orderBy := flags.String("orderBy", "id", "one of id|author|title|body|created")
+	sortOrder := flags.String("sortOrder", "asc", "asc or desc")
+	query := flags.String("query", "", "search on title and body")
+	author := flags.String("author", "", "search on author")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pagination := &httplib.Query{}
+	if err := pagination.SetPage(strconv.Itoa(*page)); err != nil {
+		return err
+	}
+	if err := pagination.SetSize(strconv.Itoa(*size)); err != nil {
+		return err
+	}
+	pagination.SetOrderBy(*orderBy)
+	pagination.SetSortOrder(*sortOrder)
+
+	param := primitive.ParameterArticleHandler{
+		Query:  *query,
+		Author: *author,
+	}
+
+	return withArticles(ctx, false, func(articles article.Article) error {
+		data, count, err := articles.Service.GetListArticle(ctx, param, pagination)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAUTHOR\tTITLE\tCREATED AT")
+		for _, article := range data {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", article.ID, article.Author, article.Title, article.CreatedAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "total: %d\n", count)
+		return w.Flush()
+	})
+}
+
+func runArticleDelete(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("article delete", flag.ContinueOnError)
+	id := flags.Int64("id", 0, "id of the article to delete")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		return errors.New(primitive.ParamIdIsZeroOrNullString)
+	}
+
+	return withArticles(ctx, true, func(articles article.Article) error {
+		if err := articles.Service.DeleteArticle(ctx, *id); err != nil {
+			return err
+		}
+		fmt.Printf("deleted article %d\n", *id)
+		return nil
+	})
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"go-gin-gorm-example/boot"
+)
+
+func runCache(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "flush" {
+		return errors.New("usage: cache flush [-pattern article*]")
+	}
+
+	flags := flag.NewFlagSet("cache flush", flag.ContinueOnError)
+	pattern := flags.String("pattern", "article*", "glob pattern of the keys to delete")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	deleted, err := boot.FlushCache(ctx, *pattern)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d keys matching %s\n", deleted, *pattern)
+	return nil
+}
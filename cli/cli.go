@@ -0,0 +1,120 @@
+// Package cli holds the admin subcommands of the binary, they reuse the boot wiring
+// (config, postgres, sqlite or in-memory repository, redis) without starting the http server.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/module/article"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"migrate": {
+		usage: "migrate up|down|status|to=N",
+		run:   runMigrate,
+	},
+	"seed": {
+		usage: "seed [-count N]",
+		run:   runSeed,
+	},
+	"export": {
+		usage: "export [-file articles.ndjson] [-format json|ndjson|csv]",
+		run:   runExport,
+	},
+	"import": {
+		usage: "import [-file articles.ndjson] [-format json|ndjson|csv] [-mode upsert|append] [-dry-run] [-batch N]",
+		run:   runImport,
+	},
+	"copy": {
+		usage: "copy [-from memory|postgres|sqlite] [-to memory|postgres|sqlite] [-file article.json] [-batch N] [-force]",
+		run:   runCopy,
+	},
+	"article": {
+		usage: "article create|list|delete [flags]",
+		run:   runArticle,
+	},
+	"cache": {
+		usage: "cache flush [-pattern article*]",
+		run:   runCache,
+	},
+	"secrets": {
+		usage: secretsCommandUsage,
+		run:   runSecrets,
+	},
+}
+
+// Run execute the admin command given on the command line, for example `article list -size 5`.
+func Run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w, available: %s", ErrUnknownCommand, strings.Join(Names(), ", "))
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w %q, available: %s", ErrUnknownCommand, args[0], strings.Join(Names(), ", "))
+	}
+	return cmd.run(context.Background(), args[1:])
+}
+
+// Names return the sorted name of every admin command.
+func Names() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Usage print the usage of every admin command.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  serve (default)")
+	for _, name := range Names() {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+// withArticles wire the dependencies and the article service, and load the in-memory snapshot when no
+// database is enabled, when persist is true the snapshot is written back after fn succeed.
+func withArticles(ctx context.Context, persist bool, fn func(articles article.Article) error) error {
+	dependencies := boot.MakeDependencies()
+	articles, err := article.MakeArticle(dependencies)
+	if err != nil {
+		return err
+	}
+	if err = dependencies.Lifecycle.Start(ctx); err != nil {
+		return err
+	}
+	//close the connections and the write-ahead log once the command is done
+	defer dependencies.Lifecycle.Stop(context.Background())
+
+	inMemory := !config.Conf.DatabaseEnabled()
+	if inMemory {
+		if err = articles.Service.LoadArticleToFile(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err = fn(articles); err != nil {
+		return err
+	}
+
+	if inMemory && persist {
+		return articles.Service.RecordArticleToFile(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"go-gin-gorm-example/infrastructure/config"
+	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/primitive"
+)
+
+func runCopy(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("copy", flag.ContinueOnError)
+	from := flags.String("from", article.BackendMemory, "source backend, memory, postgres or sqlite")
+	to := flags.String("to", article.BackendPostgres, "destination backend, memory, postgres or sqlite")
+	file := flags.String("file", "", "snapshot file of the memory backend, inMemory.snapshotPath by default")
+	batchSize := flags.Int("batch", 500, "number of articles copied per batch")
+	force := flags.Bool("force", false, "copy even if the destination already has articles")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == *to {
+		return errors.New("source and destination backend must be different")
+	}
+
+	//initiate config and logger, the backends are opened regardless of database.driver
+	if err := config.Initialize(); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	//the report is printed on stdout, the logs go to stderr instead
+	if err := logger.Init(logger.WithoutStdout(config.Conf)); err != nil {
+		return fmt.Errorf("initiate logger: %w", err)
+	}
+	defer logger.Close()
+	if *file == "" {
+		*file = config.Conf.InMemory.SnapshotPath
+	}
+
+	source, err := article.MakeRepositoryBackend(*from, *file)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer source.Close(false)
+
+	destination, err := article.MakeRepositoryBackend(*to, *file)
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+
+	existing, err := destination.Repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		_ = destination.Close(false)
+		return err
+	}
+	if existing > 0 && !*force {
+		_ = destination.Close(false)
+		return fmt.Errorf("destination %s already has %d articles, use -force to merge into it", *to, existing)
+	}
+
+	report, err := article.CopyArticles(ctx, source.Repository, destination.Repository, *batchSize)
+	if errClose := destination.Close(err == nil); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		return err
+	}
+	if !report.Verified() {
+		return errors.New("verification failed, count or checksum of the destination differ from the source")
+	}
+	return nil
+}
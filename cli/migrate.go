@@ -0,0 +1,15 @@
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"go-gin-gorm-example/boot"
+)
+
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status|to=N")
+	}
+	return boot.RunMigration(args[0])
+}
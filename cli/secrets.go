@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go-gin-gorm-example/infrastructure/config"
+)
+
+const secretsCommandUsage = "secrets keygen|list|set|delete [-vault secrets.vault] [-key-env TEST_CACHE_CQRS_VAULT_KEY] [-name NAME] [-value VALUE]"
+
+// runSecrets manage the vault of the ${vault:name} references of the config, the value of set is read
+// from stdin without -value, to keep it out of the shell history.
+func runSecrets(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + secretsCommandUsage)
+	}
+	if args[0] == "keygen" {
+		key, err := config.GenerateVaultKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	}
+
+	flags := flag.NewFlagSet("secrets "+args[0], flag.ContinueOnError)
+	path := flags.String("vault", config.DefaultVaultPath, "path of the vault file")
+	keyEnv := flags.String("key-env", config.DefaultVaultKeyEnv, "environment variable of the vault key, in base64")
+	name := flags.String("name", "", "name of the secret, referenced as ${vault:name}")
+	value := flags.String("value", "", "value of the secret, read from stdin when empty")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	key, err := config.VaultKeyFromEnv(*keyEnv)
+	if err != nil {
+		return err
+	}
+	vault := config.NewVault(*path, key)
+	secrets, err := vault.Read()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(secrets))
+		for secretName := range secrets {
+			names = append(names, secretName)
+		}
+		sort.Strings(names)
+		for _, secretName := range names {
+			fmt.Println(secretName)
+		}
+		return nil
+	case "set":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		if *value == "" {
+			if *value, err = readSecretValue(); err != nil {
+				return err
+			}
+		}
+		secrets[*name] = *value
+	case "delete":
+		if _, ok := secrets[*name]; !ok {
+			return fmt.Errorf("secret %q is not in the vault %s", *name, *path)
+		}
+		delete(secrets, *name)
+	default:
+		return errors.New("usage: " + secretsCommandUsage)
+	}
+
+	if err = vault.Write(secrets); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s in %s\n", args[0], *name, *path)
+	return nil
+}
+
+func readSecretValue() (string, error) {
+	fmt.Fprint(os.Stderr, "secret value: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read secret value: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("secret value is empty")
+	}
+	return line, nil
+}
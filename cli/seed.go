@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/primitive"
+)
+
+func runSeed(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := flags.Int("count", 10, "number of articles to create")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return withArticles(ctx, true, func(articles article.Article) error {
+		for i := 1; i <= *count; i++ {
+			_, err := articles.Service.RecordArticle(ctx, primitive.ArticleReq{
+				Author: fmt.Sprintf("seed author %d", i),
+				Title:  fmt.Sprintf("seed title %d", i),
+				Body:   fmt.Sprintf("seed body %d", i),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("seeded %d articles\n", *count)
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/primitive"
+)
+
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	file := flags.String("file", "-", "destination file, - for stdout")
+	format := flags.String("format", "", "one of json|ndjson|csv, guessed from the file extension when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = article.FormatFromFileName(*file)
+	}
+
+	return withArticles(ctx, false, func(articles article.Article) error {
+		w, closeFn, err := openOutput(*file)
+		if err != nil {
+			return err
+		}
+
+		total, err := articles.Service.ExportArticle(ctx, w, *format)
+		if errClose := closeFn(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "exported %d articles\n", total)
+		return nil
+	})
+}
+
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := flags.String("file", "-", "source file, - for stdin")
+	format := flags.String("format", "", "one of json|ndjson|csv, guessed from the file extension when empty")
+	mode := flags.String("mode", article.ImportModeUpsert, "upsert keep the ids of the file, append assign new ids")
+	dryRun := flags.Bool("dry-run", false, "only validate the file and print the report")
+	batchSize := flags.Int("batch", 500, "number of articles saved per batch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = article.FormatFromFileName(*file)
+	}
+
+	param := primitive.ParameterImportArticle{
+		Format:    *format,
+		Mode:      *mode,
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	}
+
+	return withArticles(ctx, !*dryRun, func(articles article.Article) error {
+		r, closeFn, err := openInput(*file)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		report, err := articles.Service.ImportArticle(ctx, r, param)
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if errEncode := encoder.Encode(report); errEncode != nil && err == nil {
+			err = errEncode
+		}
+		return err
+	})
+}
+
+func openOutput(file string) (io.Writer, func() error, error) {
+	if file == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func openInput(file string) (io.Reader, func() error, error) {
+	if file == "-" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
@@ -0,0 +1,219 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenMaxCalls = 1
+)
+
+// ErrOpen is returned without calling the dependency while the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// StateClosed let every call through and count the consecutive failures.
+	StateClosed State = iota
+	// StateOpen reject every call until the open timeout is elapsed.
+	StateOpen
+	// StateHalfOpen let a few trial calls through, they close the breaker when they all succeed.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a circuit breaker: after FailureThreshold consecutive failures the calls are rejected
+// with ErrOpen for OpenTimeout, then HalfOpenMaxCalls trial calls decide whether it close or open again.
+// A call slower than SlowCallThreshold is a failure even when it succeed.
+type Breaker struct {
+	name              string
+	failureThreshold  int
+	openTimeout       time.Duration
+	halfOpenMaxCalls  int
+	slowCallThreshold time.Duration
+	isFailure         func(err error) bool
+
+	mu                sync.Mutex
+	state             State
+	generation        uint64
+	failures          int
+	openedAt          time.Time
+	halfOpenCalls     int
+	halfOpenSuccesses int
+}
+
+// New build the breaker name of conf, isFailure tell which errors are a failure of the dependency
+// and not of the call (like a record not found), nil count every error.
+func New(name string, conf config.CircuitBreakerConfig, isFailure func(err error) bool) *Breaker {
+	b := &Breaker{
+		name:              name,
+		failureThreshold:  conf.FailureThreshold,
+		openTimeout:       conf.OpenTimeout,
+		halfOpenMaxCalls:  conf.HalfOpenMaxCalls,
+		slowCallThreshold: conf.SlowCallThreshold,
+		isFailure:         isFailure,
+	}
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultFailureThreshold
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultOpenTimeout
+	}
+	if b.halfOpenMaxCalls <= 0 {
+		b.halfOpenMaxCalls = defaultHalfOpenMaxCalls
+	}
+	if b.isFailure == nil {
+		b.isFailure = func(err error) bool {
+			return true
+		}
+	}
+	return b
+}
+
+// Name return the name of the breaker.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State return the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(time.Now())
+}
+
+// Execute call fn when the breaker allow it and record its outcome, it return ErrOpen without calling fn otherwise.
+// A call cancelled by the caller, like a client going away, is recorded neither as a success nor as a failure.
+func (b *Breaker) Execute(fn func() error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = fn()
+	if errors.Is(err, context.Canceled) {
+		b.release(generation)
+		return err
+	}
+	failure := err != nil && b.isFailure(err)
+	if b.slowCallThreshold > 0 && time.Since(start) > b.slowCallThreshold {
+		failure = true
+	}
+	b.record(generation, failure)
+	return err
+}
+
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(time.Now()) {
+	case StateOpen:
+		return 0, ErrOpen
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.halfOpenMaxCalls {
+			return 0, ErrOpen
+		}
+		b.halfOpenCalls++
+	}
+	return b.generation, nil
+}
+
+// record count the outcome of a call, a call started before the last change of state is ignored.
+// release give back the half-open call of a call without outcome.
+func (b *Breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.currentState(time.Now()) == StateHalfOpen && b.halfOpenCalls > 0 {
+		b.halfOpenCalls--
+	}
+}
+
+func (b *Breaker) record(generation uint64, failure bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	state := b.currentState(now)
+	if generation != b.generation {
+		return
+	}
+
+	switch state {
+	case StateClosed:
+		if !failure {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failure {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.halfOpenMaxCalls {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// currentState move an open breaker to half-open once the open timeout is elapsed, b.mu must be held.
+func (b *Breaker) currentState(now time.Time) State {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.openTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+	return b.state
+}
+
+// setState start a new generation of calls in state, b.mu must be held.
+func (b *Breaker) setState(state State, now time.Time) {
+	if state == b.state {
+		return
+	}
+	previous := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.halfOpenCalls = 0
+	b.halfOpenSuccesses = 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+
+	switch state {
+	case StateOpen:
+		log.Warnf("circuit breaker %s is open for %s (was %s)", b.name, b.openTimeout, previous)
+	case StateHalfOpen:
+		log.Infof("circuit breaker %s is half-open, trying %d calls", b.name, b.halfOpenMaxCalls)
+	case StateClosed:
+		log.Infof("circuit breaker %s is closed", b.name)
+	}
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/mitchellh/mapstructure"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
@@ -36,25 +40,94 @@ func initialiseDefaults(v *viper.Viper) {
 	}
 }
 
-func Initialize() {
+// Initialize load the configuration in Conf, it fail when the configuration can't be read or is not valid.
+func Initialize() error {
+	conf, src, err := load()
+	if err != nil {
+		return err
+	}
+	Conf = conf
+	current.Store(&conf)
+	loadedFrom = src
+	return nil
+}
+
+// Load read and validate the configuration from the remote server, or the file and the environment,
+// without changing Conf.
+func Load() (Config, error) {
+	conf, _, err := load()
+	return conf, err
+}
+
+// source is where the configuration was read, the remote server or a file, none for the environment only.
+type source struct {
+	remote bool
+	file   string
+}
+
+func load() (Config, source, error) {
+	var src source
 	v := viper.New()
 	initialiseDefaults(v)
 	if err := initialiseRemote(v); err != nil {
 		log.Warningf("No remote server configured will load configuration from file and environment variables: %+v", err)
 		if err := initialiseFileAndEnv(v, Env); err != nil {
 			var configFileNotFoundError viper.ConfigFileNotFoundError
-			if errors.As(err, &configFileNotFoundError) {
-				log.Warning("No 'config.yaml' file found on search paths. Will either use environment variables or defaults")
+			if !errors.As(err, &configFileNotFoundError) {
+				return Config{}, src, fmt.Errorf("read config file: %w", err)
 			}
+			log.Warning("No 'config.yaml' file found on search paths. Will either use environment variables or defaults")
 		}
+		src.file = v.ConfigFileUsed()
+	} else {
+		src.remote = true
 	}
 
-	err := v.Unmarshal(&Conf)
+	upgradeConnectTimeout(v)
+	var conf Config
+	err := v.Unmarshal(&conf, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		durationDecodeHook(),
+		mapstructure.StringToSliceHookFunc(","),
+	)))
 	if err != nil {
-		log.Printf("Error un-marshalling configuration: %s", err.Error())
+		return Config{}, src, fmt.Errorf("decode config: %w", err)
+	}
+	if err = resolveSecrets(&conf); err != nil {
+		return Config{}, src, fmt.Errorf("resolve secrets: %w", err)
 	}
+	if err = conf.Validate(); err != nil {
+		return Config{}, src, err
+	}
+	return conf, src, nil
 }
 
+// upgradeConnectTimeout read a postgres.connectTimeout without unit as the connection max lifetime
+// in minutes, like before postgres.connMaxLifetime was added. It is deprecated and logged.
+func upgradeConnectTimeout(v *viper.Viper) {
+	value := strings.TrimSpace(fmt.Sprint(v.Get("postgres.connectTimeout")))
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes == 0 {
+		return
+	}
+	log.Warningf("postgres.connectTimeout %d without unit is deprecated, it is read as postgres.connMaxLifetime of %d minutes: "+
+		"set postgres.connMaxLifetime: %dm and postgres.connectTimeout to a duration like 10s instead", minutes, minutes, minutes)
+	if !v.IsSet("postgres.connMaxLifetime") {
+		v.Set("postgres.connMaxLifetime", fmt.Sprintf("%dm", minutes))
+	}
+	v.Set("postgres.connectTimeout", "0")
+}
+
+const (
+	DefaultVaultPath   = "secrets.vault"
+	DefaultVaultKeyEnv = "TEST_CACHE_CQRS_VAULT_KEY"
+)
+
+const (
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 var (
 	Conf        Config
 	Env         string
@@ -73,9 +146,42 @@ var (
 	}
 	configDefaults = map[string]interface{}{
 		"port":       1234,
+		"interval":   "second",
 		"logLevel":   "DEBUG",
 		"logFormat":  "text",
 		"signString": "supersecret",
+
+		"inMemory.snapshotPath": "article.json",
+		"database.sqlite.path":  "article.db",
+
+		"metrics.path": "/metrics",
+
+		"accessLog.enableAccessLog":   true,
+		"accessLog.successSampleRate": 1,
+		"accessLog.slowThreshold":     "1s",
+		"accessLog.maxBodySize":       4096,
+		"accessLog.redactHeaders":     []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		"accessLog.redactFields":      []string{"password", "token", "secret", "apiKey"},
+		"admin.username":              "admin",
+		"admin.maxDebugWindow":        "1h",
+		"reload.enableReload":         true,
+		"reload.pollInterval":         "30s",
+		"redis.cacheTTL":              "1m",
+		"idempotency.inFlightTTL":     "1m",
+		"secrets.vaultPath":           DefaultVaultPath,
+		"secrets.vaultKeyEnv":         DefaultVaultKeyEnv,
+		"shutdown.drainTimeout":       "15s",
+		"shutdown.hookTimeout":        "5s",
+
+		"tracing.serviceName": "go-gin-gorm-example",
+		"tracing.exporter":    "otlp",
+		"tracing.filePath":    "traces.json",
+		"tracing.sampleRatio": 1,
+
+		"startup.retry.maxAttempts":     5,
+		"startup.retry.initialInterval": "500ms",
+		"startup.retry.maxInterval":     "30s",
+		"startup.retry.multiplier":      2,
 	}
 	configName = map[string]string{
 		"local": "config.local",
@@ -87,35 +193,299 @@ var (
 )
 
 type Config struct {
-	Env       string         `mapstructure:"env"`
-	Port      int            `mapstructure:"port"`
-	LogLevel  string         `mapstructure:"logLevel"`
-	LogMode   bool           `mapstructure:"logMode"`
-	LogFormat string         `mapstructure:"logFormat"`
-	Postgres  PostgresConfig `mapstructure:"postgres"`
-	Redis     RedisConfig    `mapstructure:"redis"`
-	Rate      int64          `mapstructure:"rate"`
-	Interval  string         `mapstructure:"interval"`
+	Env       string `mapstructure:"env"`
+	Port      int    `mapstructure:"port"`
+	LogLevel  string `mapstructure:"logLevel"`
+	LogMode   bool   `mapstructure:"logMode"`
+	LogFormat string `mapstructure:"logFormat"`
+	// LogLevels override logLevel for a context, like service.GetListArticle, and the contexts under it
+	LogLevels []LogLevelConfig `mapstructure:"logLevels"`
+	// LogSinks is where the logs are written, stdout with logFormat when empty
+	LogSinks []LogSinkConfig `mapstructure:"logSinks"`
+	Database DatabaseConfig  `mapstructure:"database"`
+	Postgres PostgresConfig  `mapstructure:"postgres"`
+	Redis    RedisConfig     `mapstructure:"redis"`
+	Rate     int64           `mapstructure:"rate"`
+	// Interval is the window of Rate, like 1s, 1m or one of second|minute|hour|day
+	Interval    time.Duration     `mapstructure:"interval"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	InMemory    InMemoryConfig    `mapstructure:"inMemory"`
+	Startup     StartupConfig     `mapstructure:"startup"`
+	// CircuitBreaker protect the requests from a slow or failing redis or database
+	CircuitBreaker CircuitBreakersConfig `mapstructure:"circuitBreaker"`
+	Metrics        MetricsConfig         `mapstructure:"metrics"`
+	Tracing        TracingConfig         `mapstructure:"tracing"`
+	AccessLog      AccessLogConfig       `mapstructure:"accessLog"`
+	Admin          AdminConfig           `mapstructure:"admin"`
+	Reload         ReloadConfig          `mapstructure:"reload"`
+	Secrets        SecretsConfig         `mapstructure:"secrets"`
+	Shutdown       ShutdownConfig        `mapstructure:"shutdown"`
+	Modules        ModulesConfig         `mapstructure:"modules"`
+}
+
+// LogLevelOverrides return the levels of logLevels by context.
+func (c Config) LogLevelOverrides() map[string]string {
+	overrides := make(map[string]string, len(c.LogLevels))
+	for _, level := range c.LogLevels {
+		overrides[level.Context] = level.Level
+	}
+	return overrides
+}
+
+// DatabaseDriver return the storage of the articles, one of memory|postgres|sqlite.
+// Without database.driver it is postgres when postgres.enablePostgres is set, memory otherwise.
+func (c Config) DatabaseDriver() string {
+	if c.Database.Driver != "" {
+		return c.Database.Driver
+	}
+	if c.Postgres.EnablePostgres {
+		return DriverPostgres
+	}
+	return DriverMemory
+}
+
+// DatabaseEnabled return true when the articles are stored in a sql database instead of in memory.
+func (c Config) DatabaseEnabled() bool {
+	return c.DatabaseDriver() != DriverMemory
+}
+
+// LogLevelConfig is a list item rather than a map, viper would split the context name on its dots.
+type LogLevelConfig struct {
+	Context string `mapstructure:"context"`
+	Level   string `mapstructure:"level"`
+}
+
+// LogSinkConfig is an output of the logs, one of stdout|file|syslog, with its own format, text or json,
+// and level, the entries less severe than Level are not written to it, every entry when empty.
+type LogSinkConfig struct {
+	Type   string          `mapstructure:"type"`
+	Format string          `mapstructure:"format"`
+	Level  string          `mapstructure:"level"`
+	File   LogFileConfig   `mapstructure:"file"`
+	Syslog LogSyslogConfig `mapstructure:"syslog"`
+}
+
+// LogFileConfig rotate the file once it reach MaxSizeMB, the rotated files are removed after
+// MaxAgeDays or when there is more than MaxBackups, zero keep them.
+type LogFileConfig struct {
+	Path       string `mapstructure:"path"`
+	MaxSizeMB  int    `mapstructure:"maxSizeMB"`
+	MaxAgeDays int    `mapstructure:"maxAgeDays"`
+	MaxBackups int    `mapstructure:"maxBackups"`
+	Compress   bool   `mapstructure:"compress"`
+}
+
+// LogSyslogConfig write to the local syslog socket when Network and Address are empty.
+type LogSyslogConfig struct {
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	Tag     string `mapstructure:"tag"`
+}
+
+// SecretsConfig is the vault of the ${vault:name} references, decrypted with the key, in base64,
+// of the environment variable VaultKeyEnv. The ${file:path} and ${env:NAME} references need no setting.
+type SecretsConfig struct {
+	VaultPath   string `mapstructure:"vaultPath"`
+	VaultKeyEnv string `mapstructure:"vaultKeyEnv"`
+}
+
+// ModulesConfig turn off the modules named in Disabled, like article or health, the other modules
+// registered are enabled.
+type ModulesConfig struct {
+	Disabled []string `mapstructure:"disabled"`
+}
+
+// ShutdownConfig bound the graceful shutdown: the requests in flight are drained for DrainTimeout,
+// then every other component is given HookTimeout to flush and close.
+type ShutdownConfig struct {
+	DrainTimeout time.Duration `mapstructure:"drainTimeout"`
+	HookTimeout  time.Duration `mapstructure:"hookTimeout"`
+}
+
+// ReloadConfig reload the configuration when the file change, or every PollInterval from the
+// remote server, the settings which can't change without restart are kept and logged.
+type ReloadConfig struct {
+	EnableReload bool          `mapstructure:"enableReload"`
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+}
+
+// AdminConfig protect the admin endpoints with basic auth, Password is required when they are enabled.
+type AdminConfig struct {
+	EnableAdmin    bool          `mapstructure:"enableAdmin"`
+	Username       string        `mapstructure:"username"`
+	Password       string        `mapstructure:"password" secret:"true"`
+	MaxDebugWindow time.Duration `mapstructure:"maxDebugWindow"`
+}
+
+// AccessLogConfig log a structured entry per request. The successful requests faster than SlowThreshold
+// are sampled with SuccessSampleRate (0 to 1), the errors and the slow requests are always logged.
+// The headers of RedactHeaders and the json fields of RedactFields are replaced, the request body is
+// logged with LogBody only when it is json and smaller than MaxBodySize.
+type AccessLogConfig struct {
+	EnableAccessLog   bool          `mapstructure:"enableAccessLog"`
+	SuccessSampleRate float64       `mapstructure:"successSampleRate"`
+	SlowThreshold     time.Duration `mapstructure:"slowThreshold"`
+	LogHeaders        bool          `mapstructure:"logHeaders"`
+	LogBody           bool          `mapstructure:"logBody"`
+	MaxBodySize       int64         `mapstructure:"maxBodySize"`
+	RedactHeaders     []string      `mapstructure:"redactHeaders"`
+	RedactFields      []string      `mapstructure:"redactFields"`
+}
+
+// TracingConfig export the opentelemetry traces, Exporter is one of otlp|stdout|file.
+// With otlp the spans are sent over http to Endpoint (host:port, OTEL_EXPORTER_OTLP_ENDPOINT when empty),
+// with file they are written as json lines to FilePath. SampleRatio is the ratio of the traces started
+// by this service which are kept, the sampling decision of the caller is followed.
+type TracingConfig struct {
+	EnableTracing bool    `mapstructure:"enableTracing"`
+	ServiceName   string  `mapstructure:"serviceName"`
+	Exporter      string  `mapstructure:"exporter"`
+	Endpoint      string  `mapstructure:"endpoint"`
+	Insecure      bool    `mapstructure:"insecure"`
+	FilePath      string  `mapstructure:"filePath"`
+	SampleRatio   float64 `mapstructure:"sampleRatio"`
+}
+
+// MetricsConfig expose the prometheus metrics on Path.
+type MetricsConfig struct {
+	EnableMetrics bool   `mapstructure:"enableMetrics"`
+	Path          string `mapstructure:"path"`
+}
+
+// CircuitBreakersConfig is the circuit breaker of each dependency.
+type CircuitBreakersConfig struct {
+	Redis    CircuitBreakerConfig `mapstructure:"redis"`
+	Database CircuitBreakerConfig `mapstructure:"database"`
+}
+
+// CircuitBreakerConfig open the breaker after FailureThreshold consecutive failures or calls slower
+// than SlowCallThreshold (0 disable it), the calls are rejected for OpenTimeout then HalfOpenMaxCalls
+// trial calls close it when they all succeed.
+type CircuitBreakerConfig struct {
+	EnableCircuitBreaker bool          `mapstructure:"enableCircuitBreaker"`
+	FailureThreshold     int           `mapstructure:"failureThreshold"`
+	OpenTimeout          time.Duration `mapstructure:"openTimeout"`
+	HalfOpenMaxCalls     int           `mapstructure:"halfOpenMaxCalls"`
+	SlowCallThreshold    time.Duration `mapstructure:"slowCallThreshold"`
+}
+
+// StartupConfig configure the first connection to the database and redis, retried with Retry.
+// In DegradedMode a postgres or redis still down after the retries doesn't stop the boot: the server
+// answer the health check as not ready and reconnect in the background.
+type StartupConfig struct {
+	DegradedMode bool        `mapstructure:"degradedMode"`
+	Retry        RetryConfig `mapstructure:"retry"`
+}
+
+// RetryConfig is an exponential backoff with jitter, MaxAttempts 0 retry forever.
+type RetryConfig struct {
+	MaxAttempts     int           `mapstructure:"maxAttempts"`
+	InitialInterval time.Duration `mapstructure:"initialInterval"`
+	MaxInterval     time.Duration `mapstructure:"maxInterval"`
+	Multiplier      float64       `mapstructure:"multiplier"`
+}
+
+// DatabaseConfig select the storage of the articles, Driver is one of memory|postgres|sqlite.
+type DatabaseConfig struct {
+	Driver string       `mapstructure:"driver"`
+	SQLite SQLiteConfig `mapstructure:"sqlite"`
+}
+
+// SQLiteConfig configure the embedded sqlite database, Path ":memory:" keep it in memory only.
+type SQLiteConfig struct {
+	Path        string `mapstructure:"path"`
+	AutoMigrate bool   `mapstructure:"autoMigrate"`
+}
+
+// InMemoryConfig configure the persistence of the in-memory repository used when postgres is disabled.
+// Snapshots are written atomically to SnapshotPath every SnapshotInterval (0 only on shutdown),
+// the previous SnapshotRetention snapshots are kept as backup.
+type InMemoryConfig struct {
+	SnapshotPath      string        `mapstructure:"snapshotPath"`
+	SnapshotInterval  time.Duration `mapstructure:"snapshotInterval"`
+	SnapshotRetention int           `mapstructure:"snapshotRetention"`
+	WAL               WALConfig     `mapstructure:"wal"`
+}
+
+// WALConfig configure the write-ahead log of the in-memory repository,
+// SyncPolicy is one of always|interval|never.
+type WALConfig struct {
+	EnableWAL       bool          `mapstructure:"enableWal"`
+	Path            string        `mapstructure:"path"`
+	SyncPolicy      string        `mapstructure:"syncPolicy"`
+	SyncInterval    time.Duration `mapstructure:"syncInterval"`
+	CompactInterval time.Duration `mapstructure:"compactInterval"`
+	CompactSize     int64         `mapstructure:"compactSize"`
+}
+
+// IdempotencyConfig configure the Idempotency-Key support,
+// records are stored on redis when it is enabled, otherwise in memory.
+type IdempotencyConfig struct {
+	EnableIdempotency bool          `mapstructure:"enableIdempotency"`
+	TTL               time.Duration `mapstructure:"ttl"`
+	// InFlightTTL keep the key of a request still executed, a crashed request free it once expired
+	InFlightTTL time.Duration `mapstructure:"inFlightTTL"`
 }
 
 // PostgresConfig ...
 type PostgresConfig struct {
-	ConnMaxLifetime    int    `mapstructure:"connectTimeout"`
-	MaxOpenConnections int    `mapstructure:"maxOpenConnections"`
-	MaxIdleConnections int    `mapstructure:"maxIdleConnections"`
-	Host               string `mapstructure:"host"`
-	Port               string `mapstructure:"port"`
-	Schema             string `mapstructure:"schema"`
-	DBName             string `mapstructure:"dbName"`
-	User               string `mapstructure:"user"`
-	Password           string `mapstructure:"password"`
-	EnablePostgres     bool   `mapstructure:"enablePostgres"`
+	ConnMaxLifetime    time.Duration `mapstructure:"connMaxLifetime"`
+	ConnectTimeout     time.Duration `mapstructure:"connectTimeout"`
+	MaxOpenConnections int           `mapstructure:"maxOpenConnections"`
+	MaxIdleConnections int           `mapstructure:"maxIdleConnections"`
+	Host               string        `mapstructure:"host"`
+	Port               string        `mapstructure:"port"`
+	Schema             string        `mapstructure:"schema"`
+	DBName             string        `mapstructure:"dbName"`
+	User               string        `mapstructure:"user"`
+	Password           string        `mapstructure:"password" secret:"true"`
+	EnablePostgres     bool          `mapstructure:"enablePostgres"`
+	AutoMigrate        bool          `mapstructure:"autoMigrate"`
+	Replica            ReplicaConfig `mapstructure:"replica"`
+}
+
+// ReplicaConfig route the reads of postgres to the read replicas Hosts, the writes stay on the primary.
+// A client reads from the primary for Stickiness after its last write, a replica failing its health check
+// every CheckInterval or lagging behind the primary more than MaxLag is ejected until it recovers.
+type ReplicaConfig struct {
+	Hosts         []ReplicaHostConfig `mapstructure:"hosts"`
+	Stickiness    time.Duration       `mapstructure:"stickiness"`
+	CheckInterval time.Duration       `mapstructure:"checkInterval"`
+	MaxLag        time.Duration       `mapstructure:"maxLag"`
+}
+
+// ReplicaHostConfig is one read replica, User and Password default to the ones of the primary.
+type ReplicaHostConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password" secret:"true"`
 }
 
 type RedisConfig struct {
 	Host        string `mapstructure:"host"`
-	Password    string `mapstructure:"password"`
+	Password    string `mapstructure:"password" secret:"true"`
 	DB          int    `mapstructure:"db"`
 	Port        int    `mapstructure:"port"`
 	EnableRedis bool   `mapstructure:"enableRedis"`
+	// CacheTTL is how long the articles are cached, 0 is 1m
+	CacheTTL   time.Duration    `mapstructure:"cacheTTL"`
+	LocalCache LocalCacheConfig `mapstructure:"localCache"`
+	// HealthCheckInterval is how often redis is pinged to detect it went down, 0 is 5s
+	HealthCheckInterval time.Duration `mapstructure:"healthCheckInterval"`
+}
+
+// LocalCacheConfig configure the in-process cache (L1) placed in front of redis (L2).
+type LocalCacheConfig struct {
+	EnableLocalCache    bool                     `mapstructure:"enableLocalCache"`
+	MaxEntries          int                      `mapstructure:"maxEntries"`
+	InvalidationChannel string                   `mapstructure:"invalidationChannel"`
+	Prefixes            []LocalCachePrefixConfig `mapstructure:"prefixes"`
+}
+
+// LocalCachePrefixConfig enable the local cache for the keys starting with Prefix,
+// every entry is kept locally at most for TTL.
+type LocalCachePrefixConfig struct {
+	Prefix string        `mapstructure:"prefix"`
+	TTL    time.Duration `mapstructure:"ttl"`
 }
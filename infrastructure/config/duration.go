@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const day = 24 * time.Hour
+
+// durationUnits are the durations which can be written as a word, like interval: "minute".
+var durationUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    day,
+	"week":   7 * day,
+	"month":  30 * day,
+	"year":   365 * day,
+}
+
+// ParseDuration parse a duration of time.ParseDuration, like "1h30m", a number of days or weeks,
+// like "7d" or "2w", or a unit word, like "day".
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if unit, ok := durationUnits[strings.ToLower(value)]; ok {
+		return unit, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": day, "w": 7 * day} {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			if n, err := strconv.ParseFloat(number, 64); err == nil {
+				return time.Duration(n * float64(unit)), nil
+			}
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("duration %q is not valid, use a number with a unit like 500ms, 10s, 5m, 2h, 7d or one of second|minute|hour|day|week|month|year", value)
+	}
+	return duration, nil
+}
+
+// durationDecodeHook decode the time.Duration with ParseDuration, a number without unit is only
+// accepted for 0, it would be read as nanoseconds.
+func durationDecodeHook() mapstructure.DecodeHookFuncType {
+	durationType := reflect.TypeOf(time.Duration(0))
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != durationType || from == durationType {
+			return data, nil
+		}
+		switch from.Kind() {
+		case reflect.String:
+			if data.(string) == "" {
+				return time.Duration(0), nil
+			}
+			return ParseDuration(data.(string))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if reflect.ValueOf(data).IsZero() {
+				return time.Duration(0), nil
+			}
+			return nil, fmt.Errorf("duration %v has no unit, use a number with a unit like 500ms, 10s, 5m, 2h or 7d", data)
+		default:
+			return data, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const maskedValue = "******"
+
+// MaskedYAML return the configuration as yaml, with the keys of the config file and the values of
+// the fields tagged secret masked.
+func (c Config) MaskedYAML() ([]byte, error) {
+	return yaml.Marshal(maskedValueOf(reflect.ValueOf(c)))
+}
+
+func maskedValueOf(value reflect.Value) interface{} {
+	if duration, ok := value.Interface().(time.Duration); ok {
+		return duration.String()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]interface{}, value.NumField())
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := keyOf(field)
+			if field.Tag.Get("secret") == "true" {
+				fields[name] = maskedString(value.Field(i).String())
+				continue
+			}
+			fields[name] = maskedValueOf(value.Field(i))
+		}
+		return fields
+	case reflect.Slice:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = maskedValueOf(value.Index(i))
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			entries[iter.Key().String()] = maskedValueOf(iter.Value())
+		}
+		return entries
+	default:
+		return value.Interface()
+	}
+}
+
+// maskedString keep an empty secret empty, to tell a missing secret apart.
+func maskedString(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedValue
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadable are the keys applied without restart on a reload, a subscriber of the key apply it.
+var reloadable = []string{
+	"rate",
+	"interval",
+	"logLevel",
+	"logLevels",
+	"redis.cacheTTL",
+	"redis.localCache.prefixes",
+	"accessLog.successSampleRate",
+	"accessLog.slowThreshold",
+	"accessLog.logHeaders",
+	"accessLog.logBody",
+	"accessLog.maxBodySize",
+	"accessLog.redactHeaders",
+	"accessLog.redactFields",
+}
+
+const defaultPollInterval = 30 * time.Second
+
+type subscriber struct {
+	name string
+	keys []string
+	fn   func(conf Config) error
+}
+
+var (
+	// current is Conf with the reloadable changes applied since, Conf is not changed after the boot
+	current    atomic.Pointer[Config]
+	loadedFrom source
+
+	reloadMu      sync.Mutex
+	subscribersMu sync.Mutex
+	subscribers   []subscriber
+)
+
+// Current return the configuration in use, Conf with the changes applied by the reloads.
+func Current() Config {
+	if conf := current.Load(); conf != nil {
+		return *conf
+	}
+	return Conf
+}
+
+// Subscribe call fn with the configuration in use after a reload changed one of keys, or a key under them.
+// name identify the subscriber in the logs.
+func Subscribe(name string, fn func(conf Config) error, keys ...string) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, subscriber{name: name, keys: keys, fn: fn})
+}
+
+// Reload read the configuration again and apply the reloadable settings changed, the changes of the
+// other settings need a restart, they are logged and ignored. An invalid configuration is not applied.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := Load()
+	if err != nil {
+		log.Errorf("config reload rejected: %v", err)
+		return err
+	}
+
+	previous := Current()
+	applied := previous
+	var live, restart []string
+	for _, key := range changedKeys(previous, next) {
+		if !isReloadable(key) {
+			restart = append(restart, key)
+			continue
+		}
+		copyKey(reflect.ValueOf(&applied).Elem(), reflect.ValueOf(next), key)
+		live = append(live, key)
+	}
+	if len(restart) > 0 {
+		log.Warnf("config changes of %s need a restart, they are ignored", strings.Join(restart, ", "))
+	}
+	if len(live) == 0 {
+		return nil
+	}
+
+	current.Store(&applied)
+	log.Infof("config reloaded, applied changes of %s", strings.Join(live, ", "))
+	notify(applied, live)
+	return nil
+}
+
+func notify(conf Config, changed []string) {
+	subscribersMu.Lock()
+	notified := make([]subscriber, len(subscribers))
+	copy(notified, subscribers)
+	subscribersMu.Unlock()
+
+	for _, s := range notified {
+		if !matchAny(changed, s.keys) {
+			continue
+		}
+		if err := s.fn(conf); err != nil {
+			log.Errorf("config reload of %s failed: %v", s.name, err)
+		}
+	}
+}
+
+// Watch reload the configuration when the config file change, or every reload.pollInterval when it is
+// read from the remote server, until stop is called.
+func Watch() (stop func()) {
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	stop = func() {
+		stopOnce.Do(func() { close(done) })
+	}
+	if !Conf.Reload.EnableReload {
+		return stop
+	}
+
+	switch {
+	case loadedFrom.remote:
+		interval := Conf.Reload.PollInterval
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					_ = Reload()
+				}
+			}
+		}()
+		log.Infof("config reloaded from the remote server every %s", interval)
+	case loadedFrom.file != "":
+		if err := watchFile(loadedFrom.file, done); err != nil {
+			log.Errorf("config file %s is not watched: %v", loadedFrom.file, err)
+			return stop
+		}
+		log.Infof("config reloaded when %s change", loadedFrom.file)
+	}
+	return stop
+}
+
+// watchFile reload the configuration when file change until done is closed. The directory is watched,
+// the editors and the kubernetes config maps replace the file, through a symlink for the config maps.
+func watchFile(file string, done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file = filepath.Clean(file)
+	if err = watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	realFile, _ := filepath.EvalSymlinks(file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentFile, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if written || (currentFile != "" && currentFile != realFile) {
+					realFile = currentFile
+					_ = Reload()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("config watcher of %s: %v", file, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func isReloadable(key string) bool {
+	for _, r := range reloadable {
+		if key == r {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny return true when one of keys is one of prefixes or under it.
+func matchAny(keys, prefixes []string) bool {
+	for _, key := range keys {
+		for _, prefix := range prefixes {
+			if key == prefix || strings.HasPrefix(key, prefix+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changedKeys return the sorted keys, as in the config file, of the settings different in a and b.
+// The lists and the maps are compared as a whole.
+func changedKeys(a, b Config) []string {
+	var keys []string
+	var walk func(prefix string, a, b reflect.Value)
+	walk = func(prefix string, a, b reflect.Value) {
+		if a.Kind() != reflect.Struct {
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				keys = append(keys, prefix)
+			}
+			return
+		}
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			walk(joinKey(prefix, keyOf(field)), a.Field(i), b.Field(i))
+		}
+	}
+	walk("", reflect.ValueOf(a), reflect.ValueOf(b))
+	sort.Strings(keys)
+	return keys
+}
+
+// copyKey set the setting key of dst to the one of src.
+func copyKey(dst, src reflect.Value, key string) {
+	name, rest, _ := strings.Cut(key, ".")
+	for i := 0; i < dst.NumField(); i++ {
+		if keyOf(dst.Type().Field(i)) != name {
+			continue
+		}
+		if rest == "" {
+			dst.Field(i).Set(src.Field(i))
+			return
+		}
+		copyKey(dst.Field(i), src.Field(i), rest)
+		return
+	}
+}
+
+// keyOf return the key of field in the config file.
+func keyOf(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
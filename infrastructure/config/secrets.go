@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	SecretSchemeFile  = "file"
+	SecretSchemeEnv   = "env"
+	SecretSchemeVault = "vault"
+)
+
+// secretReference match the references to a secret in a value, like ${file:/run/secrets/db_password},
+// and the escape $${ which is replaced by a literal ${, like $${env:X} for the text ${env:X}.
+var secretReference = regexp.MustCompile(`\$\$\{|\$\{([a-zA-Z][a-zA-Z0-9_-]*):([^}]+)\}`)
+
+const escapedReference = "$${"
+
+// SecretProvider resolve the references of its scheme to the value of the secret.
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc is a SecretProvider of a function.
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		SecretSchemeFile: SecretProviderFunc(resolveFileSecret),
+		SecretSchemeEnv:  SecretProviderFunc(resolveEnvSecret),
+	}
+)
+
+// RegisterSecretProvider resolve the references ${scheme:ref} of the config with provider, it must be
+// called before the config is loaded. The vault scheme is configured by the secrets section.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// resolveFileSecret read the secret from a file, like the docker and kubernetes secrets mounted
+// in /run/secrets, without the trailing newline.
+func resolveFileSecret(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func resolveEnvSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveSecrets replace the secret references in every string of conf, the vault is only opened
+// when a value reference it.
+func resolveSecrets(conf *Config) error {
+	secretProvidersMu.RLock()
+	providers := make(map[string]SecretProvider, len(secretProviders)+1)
+	for scheme, provider := range secretProviders {
+		providers[scheme] = provider
+	}
+	secretProvidersMu.RUnlock()
+	if _, ok := providers[SecretSchemeVault]; !ok {
+		providers[SecretSchemeVault] = &vaultProvider{conf: conf.Secrets}
+	}
+
+	return resolveValue(reflect.ValueOf(conf).Elem(), "", providers)
+}
+
+func resolveValue(value reflect.Value, key string, providers map[string]SecretProvider) error {
+	switch value.Kind() {
+	case reflect.String:
+		resolved, err := resolveString(value.String(), providers)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		value.SetString(resolved)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := resolveValue(value.Field(i), joinKey(key, keyOf(field)), providers); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := resolveValue(value.Index(i), fmt.Sprintf("%s[%d]", key, i), providers); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			resolved, err := resolveString(iter.Value().String(), providers)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", key, iter.Key(), err)
+			}
+			value.SetMapIndex(iter.Key(), reflect.ValueOf(resolved).Convert(value.Type().Elem()))
+		}
+	}
+	return nil
+}
+
+// resolveString replace the references of value, the error name the reference but never a secret.
+func resolveString(value string, providers map[string]SecretProvider) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var resolveErr error
+	resolved := secretReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if resolveErr != nil {
+			return reference
+		}
+		if reference == escapedReference {
+			return "${"
+		}
+		match := secretReference.FindStringSubmatch(reference)
+		provider, ok := providers[match[1]]
+		if !ok {
+			resolveErr = fmt.Errorf("resolve %s: secret provider %q is not registered", reference, match[1])
+			return reference
+		}
+		secret, err := provider.Resolve(match[2])
+		if err != nil {
+			resolveErr = fmt.Errorf("resolve %s: %w", reference, err)
+			return reference
+		}
+		return secret
+	})
+	return resolved, resolveErr
+}
+
+// vaultProvider resolve the references to the secrets of the vault of conf, read once on the first one.
+type vaultProvider struct {
+	conf    SecretsConfig
+	secrets map[string]string
+}
+
+func (p *vaultProvider) Resolve(name string) (string, error) {
+	if p.secrets == nil {
+		key, err := VaultKeyFromEnv(p.conf.VaultKeyEnv)
+		if err != nil {
+			return "", err
+		}
+		secrets, err := NewVault(p.conf.VaultPath, key).Read()
+		if err != nil {
+			return "", err
+		}
+		p.secrets = secrets
+	}
+
+	secret, ok := p.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q is not in the vault %s", name, p.conf.VaultPath)
+	}
+	return secret, nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("CONFIG_TEST_REDIS_PASSWORD", "from-env")
+
+	key := newVaultKey(t)
+	vaultPath := filepath.Join(dir, "secrets.vault")
+	if err := NewVault(vaultPath, key).Write(map[string]string{"api_key": "from-vault"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	t.Setenv("CONFIG_TEST_VAULT_KEY", base64.StdEncoding.EncodeToString(key))
+
+	conf := Config{
+		Secrets: SecretsConfig{VaultPath: vaultPath, VaultKeyEnv: "CONFIG_TEST_VAULT_KEY"},
+	}
+	conf.Postgres.Password = "${file:" + passwordFile + "}"
+	conf.Redis.Password = "${env:CONFIG_TEST_REDIS_PASSWORD}"
+	conf.Postgres.User = "user-${vault:api_key}-${env:CONFIG_TEST_REDIS_PASSWORD}"
+	conf.Postgres.Host = "$${env:CONFIG_TEST_REDIS_PASSWORD}"
+	conf.Postgres.DBName = "plain"
+
+	if err := resolveSecrets(&conf); err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"file", conf.Postgres.Password, "from-file"},
+		{"env", conf.Redis.Password, "from-env"},
+		{"vault and env", conf.Postgres.User, "user-from-vault-from-env"},
+		{"escaped", conf.Postgres.Host, "${env:CONFIG_TEST_REDIS_PASSWORD}"},
+		{"plain", conf.Postgres.DBName, "plain"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: resolved to %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestResolveSecretsError(t *testing.T) {
+	dir := t.TempDir()
+	key := newVaultKey(t)
+	vaultPath := filepath.Join(dir, "secrets.vault")
+	if err := NewVault(vaultPath, key).Write(map[string]string{"api_key": "s3cret"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	t.Setenv("CONFIG_TEST_VAULT_KEY", base64.StdEncoding.EncodeToString(key))
+	t.Setenv("CONFIG_TEST_WRONG_VAULT_KEY", base64.StdEncoding.EncodeToString(newVaultKey(t)))
+
+	tests := []struct {
+		name        string
+		vaultKeyEnv string
+		value       string
+	}{
+		{"missing file", "CONFIG_TEST_VAULT_KEY", "${file:" + filepath.Join(dir, "missing") + "}"},
+		{"missing env", "CONFIG_TEST_VAULT_KEY", "${env:CONFIG_TEST_MISSING}"},
+		{"missing vault secret", "CONFIG_TEST_VAULT_KEY", "${vault:missing}"},
+		{"wrong vault key", "CONFIG_TEST_WRONG_VAULT_KEY", "${vault:api_key}"},
+		{"unknown scheme", "CONFIG_TEST_VAULT_KEY", "${unknown:x}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := Config{
+				Secrets: SecretsConfig{VaultPath: vaultPath, VaultKeyEnv: tt.vaultKeyEnv},
+			}
+			conf.Postgres.Password = tt.value
+
+			err := resolveSecrets(&conf)
+			if err == nil {
+				t.Fatal("resolveSecrets returned no error")
+			}
+			if !strings.Contains(err.Error(), "postgres.password") {
+				t.Errorf("error %q doesn't name the key postgres.password", err)
+			}
+			if strings.Contains(err.Error(), "s3cret") {
+				t.Errorf("error %q contains the secret", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// validation collect every problem of the configuration, to report them all at once.
+type validation struct {
+	errs []error
+}
+
+func (v *validation) check(ok bool, key string, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validation) required(value string, key string) {
+	v.check(strings.TrimSpace(value) != "", key, "is required")
+}
+
+func (v *validation) oneOf(value string, key string, allowed ...string) {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	v.check(false, key, "%q is not valid, use one of %s", value, strings.Join(allowed, "|"))
+}
+
+func (v *validation) level(value string, key string) {
+	_, err := log.ParseLevel(value)
+	v.check(err == nil, key, "%q is not a valid level, use one of error|warn|info|debug", value)
+}
+
+// Validate check the values of the configuration and the settings required by the enabled features,
+// the error list every problem found, one per line.
+func (c Config) Validate() error {
+	v := &validation{}
+
+	v.check(c.Port > 0 && c.Port <= 65535, "port", "%d is not a valid port", c.Port)
+	v.level(c.LogLevel, "logLevel")
+	v.oneOf(c.LogFormat, "logFormat", "text", "json")
+	for i, level := range c.LogLevels {
+		v.required(level.Context, fmt.Sprintf("logLevels[%d].context", i))
+		v.level(level.Level, fmt.Sprintf("logLevels[%d].level", i))
+	}
+	for i, sink := range c.LogSinks {
+		key := fmt.Sprintf("logSinks[%d]", i)
+		v.oneOf(sink.Type, key+".type", "stdout", "stderr", "file", "syslog")
+		if sink.Format != "" {
+			v.oneOf(sink.Format, key+".format", "text", "json")
+		}
+		if sink.Level != "" {
+			v.level(sink.Level, key+".level")
+		}
+	}
+
+	v.check(c.Rate >= 0, "rate", "must not be negative")
+	v.check(c.Interval > 0, "interval", "must be positive")
+
+	v.oneOf(c.DatabaseDriver(), "database.driver", DriverMemory, DriverPostgres, DriverSQLite)
+	switch c.DatabaseDriver() {
+	case DriverPostgres:
+		v.required(c.Postgres.Host, "postgres.host")
+		v.required(c.Postgres.Port, "postgres.port")
+		v.required(c.Postgres.DBName, "postgres.dbName")
+		v.required(c.Postgres.User, "postgres.user")
+		v.check(c.Postgres.ConnMaxLifetime >= 0, "postgres.connMaxLifetime", "must not be negative")
+		v.check(c.Postgres.ConnectTimeout >= 0, "postgres.connectTimeout", "must not be negative")
+		for i, replica := range c.Postgres.Replica.Hosts {
+			v.required(replica.Host, fmt.Sprintf("postgres.replica.hosts[%d].host", i))
+			v.required(replica.Port, fmt.Sprintf("postgres.replica.hosts[%d].port", i))
+		}
+	case DriverSQLite:
+		v.required(c.Database.SQLite.Path, "database.sqlite.path")
+	case DriverMemory:
+		v.required(c.InMemory.SnapshotPath, "inMemory.snapshotPath")
+		if c.InMemory.WAL.EnableWAL {
+			v.required(c.InMemory.WAL.Path, "inMemory.wal.path")
+			if c.InMemory.WAL.SyncPolicy != "" {
+				v.oneOf(c.InMemory.WAL.SyncPolicy, "inMemory.wal.syncPolicy", "always", "interval", "never")
+			}
+		}
+	}
+
+	if c.Redis.EnableRedis {
+		v.required(c.Redis.Host, "redis.host")
+		v.check(c.Redis.Port > 0 && c.Redis.Port <= 65535, "redis.port", "%d is not a valid port", c.Redis.Port)
+		v.check(c.Redis.DB >= 0, "redis.db", "must not be negative")
+	}
+	if c.Idempotency.EnableIdempotency {
+		v.check(c.Idempotency.TTL > 0, "idempotency.ttl", "must be positive")
+		v.check(c.Idempotency.InFlightTTL > 0, "idempotency.inFlightTTL", "must be positive")
+	}
+
+	v.check(c.Startup.Retry.MaxAttempts >= 0, "startup.retry.maxAttempts", "must not be negative")
+	v.check(c.Startup.Retry.Multiplier == 0 || c.Startup.Retry.Multiplier >= 1, "startup.retry.multiplier", "must be at least 1")
+	breakers := []struct {
+		key  string
+		conf CircuitBreakerConfig
+	}{{"circuitBreaker.redis", c.CircuitBreaker.Redis}, {"circuitBreaker.database", c.CircuitBreaker.Database}}
+	for _, breaker := range breakers {
+		if breaker.conf.EnableCircuitBreaker {
+			v.check(breaker.conf.FailureThreshold >= 0, breaker.key+".failureThreshold", "must not be negative")
+			v.check(breaker.conf.OpenTimeout >= 0, breaker.key+".openTimeout", "must not be negative")
+			v.check(breaker.conf.SlowCallThreshold >= 0, breaker.key+".slowCallThreshold", "must not be negative")
+		}
+	}
+
+	if c.Metrics.EnableMetrics {
+		v.check(strings.HasPrefix(c.Metrics.Path, "/"), "metrics.path", "%q must start with /", c.Metrics.Path)
+	}
+	if c.Tracing.EnableTracing {
+		v.oneOf(c.Tracing.Exporter, "tracing.exporter", "otlp", "stdout", "file")
+		v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio", "must be between 0 and 1")
+	}
+	if c.AccessLog.EnableAccessLog {
+		v.check(c.AccessLog.SuccessSampleRate >= 0 && c.AccessLog.SuccessSampleRate <= 1, "accessLog.successSampleRate", "must be between 0 and 1")
+	}
+	v.check(c.Shutdown.DrainTimeout >= 0, "shutdown.drainTimeout", "must not be negative")
+	v.check(c.Shutdown.HookTimeout >= 0, "shutdown.hookTimeout", "must not be negative")
+	if c.Admin.EnableAdmin {
+		v.required(c.Admin.Username, "admin.username")
+		v.required(c.Admin.Password, "admin.password")
+	}
+
+	if len(v.errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(v.errs...))
+	}
+	return nil
+}
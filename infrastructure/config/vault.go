@@ -0,0 +1,129 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const vaultKeySize = 32
+
+// ErrVaultKeyNotValid is returned when the vault key is not 32 bytes encoded in base64.
+var ErrVaultKeyNotValid = errors.New("vault key must be 32 bytes encoded in base64")
+
+// Vault is a local file of secrets encrypted with AES-256-GCM, the file is the nonce followed by the
+// sealed json object of the secrets by name.
+type Vault struct {
+	path string
+	key  []byte
+}
+
+func NewVault(path string, key []byte) *Vault {
+	return &Vault{
+		path: path,
+		key:  key,
+	}
+}
+
+// GenerateVaultKey return a new random key encoded in base64, to set in the environment variable of the key.
+func GenerateVaultKey() (string, error) {
+	key := make([]byte, vaultKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// VaultKeyFromEnv decode the vault key from the environment variable name.
+func VaultKeyFromEnv(name string) ([]byte, error) {
+	encoded, ok := os.LookupEnv(name)
+	if !ok || encoded == "" {
+		return nil, fmt.Errorf("vault key environment variable %s is not set", name)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != vaultKeySize {
+		return nil, fmt.Errorf("%s: %w", name, ErrVaultKeyNotValid)
+	}
+	return key, nil
+}
+
+// Read decrypt the secrets of the vault, a vault not created yet has no secret.
+func (v *Vault) Read() (map[string]string, error) {
+	sealed, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := v.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("vault %s is corrupted", v.path)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s can't be decrypted, the key is wrong or the file is corrupted", v.path)
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("vault %s: %w", v.path, err)
+	}
+	return secrets, nil
+}
+
+// Write encrypt secrets with a new nonce and replace the vault atomically, readable by the owner only.
+func (v *Vault) Write(secrets map[string]string) error {
+	aead, err := v.aead()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), filepath.Base(v.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0600); err == nil {
+		_, err = tmp.Write(aead.Seal(nonce, nonce, plain, nil))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), v.path)
+}
+
+func (v *Vault) aead() (cipher.AEAD, error) {
+	if len(v.key) != vaultKeySize {
+		return nil, ErrVaultKeyNotValid
+	}
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
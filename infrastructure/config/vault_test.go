@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newVaultKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateVaultKey()
+	if err != nil {
+		t.Fatalf("GenerateVaultKey: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	return key
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	vault := NewVault(path, newVaultKey(t))
+
+	secrets, err := vault.Read()
+	if err != nil {
+		t.Fatalf("Read of a missing vault: %v", err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("missing vault has %d secrets, want 0", len(secrets))
+	}
+
+	want := map[string]string{"db_password": "p@ss", "redis_password": "${not a reference}"}
+	if err = vault.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := vault.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read returned %v, want %v", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("vault mode is %v, want 0600", mode)
+	}
+}
+
+func TestVaultWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	if err := NewVault(path, newVaultKey(t)).Write(map[string]string{"x": "y"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if _, err := NewVault(path, newVaultKey(t)).Read(); err == nil {
+		t.Error("Read with another key returned no error")
+	}
+	if _, err := NewVault(path, []byte("short")).Read(); err == nil {
+		t.Error("Read with a key of 5 bytes returned no error")
+	}
+}
+
+func TestVaultCorrupted(t *testing.T) {
+	key := newVaultKey(t)
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	if err := NewVault(path, key).Write(map[string]string{"x": "y"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"flipped byte", append(append([]byte(nil), sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^0xff)},
+		{"truncated", sealed[:len(sealed)/2]},
+		{"shorter than the nonce", sealed[:4]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, tt.content, 0600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			if _, err := NewVault(path, key).Read(); err == nil {
+				t.Error("Read of a corrupted vault returned no error")
+			}
+		})
+	}
+}
+
+func TestVaultKeyFromEnv(t *testing.T) {
+	const name = "CONFIG_TEST_VAULT_KEY"
+	if _, err := VaultKeyFromEnv(name); err == nil {
+		t.Error("VaultKeyFromEnv of an unset variable returned no error")
+	}
+
+	t.Setenv(name, base64.StdEncoding.EncodeToString([]byte("too short")))
+	if _, err := VaultKeyFromEnv(name); err == nil {
+		t.Error("VaultKeyFromEnv of a short key returned no error")
+	}
+
+	key := newVaultKey(t)
+	t.Setenv(name, base64.StdEncoding.EncodeToString(key))
+	got, err := VaultKeyFromEnv(name)
+	if err != nil {
+		t.Fatalf("VaultKeyFromEnv: %v", err)
+	}
+	if !reflect.DeepEqual(got, key) {
+		t.Errorf("VaultKeyFromEnv returned another key")
+	}
+}
@@ -0,0 +1,344 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-gin-gorm-example/migrations"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// migrationLockKey is the postgres advisory lock held while migrating,
+	// so two replicas starting at the same time doesn't run the same migration twice.
+	migrationLockKey int64 = 7255400283
+	migrationTable         = "schema_migrations"
+
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+	MigrateTo     = "to="
+)
+
+var (
+	// a file for a dialect (0001_name.sqlite.up.sql) replace the shared file of the same version and direction
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_(\w+)(?:\.(postgres|sqlite))?\.(up|down)\.sql$`)
+
+	ErrInvalidMigrateCommand = errors.New("invalid migrate command, use one of up|down|status|to=N")
+	ErrUnknownMigration      = errors.New("unknown migration version")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	Version   int64     `gorm:"column:version"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator read every migration file on the root of the sources for the dialect of db, sorted by version.
+// A version must be in one source only, without sources the migrations of the migrations package are read.
+func NewMigrator(db *gorm.DB, sources ...fs.FS) (*Migrator, error) {
+	if len(sources) == 0 {
+		sources = []fs.FS{migrations.FS}
+	}
+	dialect := db.Dialector.Name()
+	byVersion := make(map[int64]*Migration)
+	for _, fsys := range sources {
+		fromSource := make(map[int64]*Migration)
+		if err := readMigrations(fsys, dialect, fromSource); err != nil {
+			return nil, err
+		}
+		for version, migration := range fromSource {
+			if other, ok := byVersion[version]; ok {
+				return nil, fmt.Errorf("migration version %d is used by %s and %s", version, other.Name, migration.Name)
+			}
+			byVersion[version] = migration
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration version %d doesn't have an up file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// readMigrations add the migration files of the root of fsys for dialect to byVersion.
+func readMigrations(fsys fs.FS, dialect string, byVersion map[int64]*Migration) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	fromDialectFile := make(map[string]bool)
+	for _, entry := range entries {
+		matches := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		if matches[3] != "" && matches[3] != dialect {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return fmt.Errorf("migration version %d has two different names: %s and %s", version, migration.Name, matches[2])
+		}
+
+		direction := matches[1] + "." + matches[4]
+		if matches[3] == "" && fromDialectFile[direction] {
+			continue
+		}
+		fromDialectFile[direction] = matches[3] != ""
+
+		if matches[4] == MigrateUp {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	return nil
+}
+
+// Run execute the migrate command given from the flag, one of up|down|status|to=N.
+func (m *Migrator) Run(ctx context.Context, command string) ([]MigrationStatus, error) {
+	switch {
+	case command == MigrateUp:
+		return nil, m.Up(ctx)
+	case command == MigrateDown:
+		return nil, m.Down(ctx)
+	case command == MigrateStatus:
+		return m.Status(ctx)
+	case strings.HasPrefix(command, MigrateTo):
+		version, err := strconv.ParseInt(strings.TrimPrefix(command, MigrateTo), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidMigrateCommand
+		}
+		return nil, m.To(ctx, version)
+	default:
+		return nil, ErrInvalidMigrateCommand
+	}
+}
+
+// Up apply every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down revert the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		var last int64
+		for version := range applied {
+			if version > last {
+				last = version
+			}
+		}
+		if last == 0 {
+			log.Info("no migration to revert")
+			return nil
+		}
+		return m.migrateTo(conn, applied, m.previousVersion(last))
+	})
+}
+
+// To apply or revert migrations until the schema is on the given version,
+// version 0 means reverting everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+	return m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		return m.migrateTo(conn, applied, version)
+	})
+}
+
+// Status list every known migration and whether it is applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var result []MigrationStatus
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+			if row, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = row.AppliedAt
+			}
+			result = append(result, status)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (m *Migrator) migrateTo(conn *gorm.DB, applied map[int64]appliedMigration, target int64) error {
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > target {
+			continue
+		}
+		log.Infof("applying migration %d_%s", migration.Version, migration.Name)
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Table(migrationTable).Create(&appliedMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= target {
+			continue
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return fmt.Errorf("migration %d_%s can't be reverted, no down file", migration.Version, migration.Name)
+		}
+		log.Infof("reverting migration %d_%s", migration.Version, migration.Name)
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf("delete from %s where version = ?", migrationTable), migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// withLock run fn on a single connection holding the migration advisory lock,
+// sqlite has no advisory lock, its database is only opened by one process.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if m.dialect == "postgres" {
+			if err := conn.Exec("select pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return err
+			}
+			defer func() {
+				if err := conn.Exec("select pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+					log.Errorf("failed release migration lock: %v", err)
+				}
+			}()
+		}
+
+		err := conn.Exec(fmt.Sprintf(`create table if not exists %s (
+			version bigint primary key,
+			name varchar(255) not null,
+			applied_at timestamp not null default current_timestamp
+		)`, migrationTable)).Error
+		if err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := conn.Table(migrationTable).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) previousVersion(version int64) int64 {
+	var previous int64
+	for _, migration := range m.migrations {
+		if migration.Version < version && migration.Version > previous {
+			previous = migration.Version
+		}
+	}
+	return previous
+}
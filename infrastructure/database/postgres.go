@@ -1,12 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"time"
 
 	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/retry"
 
 	_ "github.com/lib/pq"
 	"gorm.io/driver/postgres"
@@ -16,85 +20,265 @@ import (
 )
 
 const (
-	defaultConnMaxLifeTime int = 5  // default max 5 minutes lifetime
-	defaultMaxOpenConns    int = 10 // default max 10 open connections
-	defaultMaxIdleConns    int = 10 // default max 10 idle connections
+	defaultConnMaxLifeTime     = 5 * time.Minute // default max 5 minutes lifetime
+	defaultMaxOpenConns    int = 10              // default max 10 open connections
+	defaultMaxIdleConns    int = 10              // default max 10 idle connections
 )
 
 type HandlerDatabase struct {
 	DbConn *gorm.DB
+	// Replicas is nil unless postgres.replica.hosts is configured
+	Replicas *ReplicaSet
+	// State is not ready while a database down at boot is reconnecting in degraded mode
+	State *retry.State
+	// stopReconnect is nil unless the database is reconnecting in the background
+	stopReconnect context.CancelFunc
 }
 
-func NewDatabaseClient(conf *config.Config) (HandlerDatabase, error) {
-	db := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s fallback_application_name=go-soskomlap-api-master TimeZone=Asia/Jakarta",
-		conf.Postgres.Host,
-		conf.Postgres.Port,
-		conf.Postgres.User,
-		conf.Postgres.Password,
-		conf.Postgres.DBName,
-		"disable")
-	dbConn, err := loadPsqlDb(conf.LogMode, db, conf.Postgres.MaxOpenConnections, conf.Postgres.MaxIdleConnections, conf.Postgres.ConnMaxLifetime)
+// NewDatabaseClient connect to postgres, the auto migration apply the migrations of sources.
+func NewDatabaseClient(conf *config.Config, sources ...fs.FS) (HandlerDatabase, error) {
+	dbConn, err := loadPsqlDb(conf, postgresDSN(conf.Postgres, conf.Postgres.Host, conf.Postgres.Port, conf.Postgres.User, conf.Postgres.Password))
 	if err != nil {
 		log.Printf("failed to connect database instance: %v", err)
 		return HandlerDatabase{}, err
 	}
 
+	//apply the pending schema migrations on boot when enabled
+	if conf.Postgres.AutoMigrate {
+		if err = migrate(dbConn, sources); err != nil {
+			closeConn(dbConn)
+			return HandlerDatabase{}, err
+		}
+	}
+
+	var replicas *ReplicaSet
+	if len(conf.Postgres.Replica.Hosts) > 0 {
+		replicas, err = NewReplicaSet(conf)
+		if err != nil {
+			log.Printf("failed to open read replicas: %v", err)
+			closeConn(dbConn)
+			return HandlerDatabase{}, err
+		}
+	}
+
 	return HandlerDatabase{
-		DbConn: dbConn,
+		DbConn:   dbConn,
+		Replicas: replicas,
 	}, nil
 }
 
-func loadPsqlDb(logMode bool, psqlInfo string, maxOpenConn, maxIdleConn, maxLifetime int) (*gorm.DB, error) {
-	conn, err := sql.Open("postgres", psqlInfo)
+func postgresDSN(conf config.PostgresConfig, host, port, user, password string) string {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s fallback_application_name=go-soskomlap-api-master TimeZone=Asia/Jakarta",
+		host,
+		port,
+		user,
+		password,
+		conf.DBName,
+		"disable")
+	//the driver wait forever for the connection without timeout, it is in whole seconds
+	if conf.ConnectTimeout > 0 {
+		dsn += fmt.Sprintf(" connect_timeout=%d", max(1, int(conf.ConnectTimeout.Round(time.Second).Seconds())))
+	}
+	return dsn
+}
+
+// loadPsqlDb open the pool of psqlInfo and check the database answer.
+func loadPsqlDb(conf *config.Config, psqlInfo string) (*gorm.DB, error) {
+	dbConn, err := openPsqlDb(conf, psqlInfo)
 	if err != nil {
 		return nil, err
 	}
+
 	// checking if connection to db has been established
-	err = conn.Ping()
+	sqlDB, err := dbConn.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	if err != nil {
+		closeConn(dbConn)
+		return nil, err
+	}
+	return dbConn, nil
+}
+
+// openPsqlDb open the pool of psqlInfo without connecting, the connections are made on the first query.
+func openPsqlDb(conf *config.Config, psqlInfo string) (*gorm.DB, error) {
+	conn, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		return nil, err
 	}
 
+	maxLifetime := conf.Postgres.ConnMaxLifetime
 	if maxLifetime == 0 {
 		maxLifetime = defaultConnMaxLifeTime
 	}
 
+	maxIdleConn := conf.Postgres.MaxIdleConnections
 	if maxIdleConn == 0 {
 		maxIdleConn = defaultMaxIdleConns
 	}
 
+	maxOpenConn := conf.Postgres.MaxOpenConnections
 	if maxOpenConn == 0 {
 		maxOpenConn = defaultMaxOpenConns
 	}
 
-	conn.SetConnMaxLifetime(time.Duration(maxLifetime) * time.Minute)
+	conn.SetConnMaxLifetime(maxLifetime)
 	conn.SetMaxOpenConns(maxOpenConn)
 	conn.SetMaxIdleConns(maxIdleConn)
 
+	gormConfig := newGormConfig(conf.LogMode)
+	gormConfig.DisableAutomaticPing = true
+	dbConn, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: conn,
+	}), gormConfig)
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
+	return dbConn, nil
+}
 
-	var gormConfig *gorm.Config
+// Close close the primary pool and the replicas.
+func (h HandlerDatabase) Close() error {
+	var errs []error
+	if h.Replicas != nil {
+		errs = append(errs, h.Replicas.Close())
+	}
+	if h.DbConn != nil {
+		sqlDB, err := h.DbConn.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func closeConn(dbConn *gorm.DB) {
+	if sqlDB, err := dbConn.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+// newGormConfig is the gorm config shared by every driver.
+func newGormConfig(logMode bool) *gorm.Config {
 	if logMode {
-		gormConfig = &gorm.Config{
+		return &gorm.Config{
 			PrepareStmt: true,
 			NamingStrategy: schema.NamingStrategy{
 				SingularTable: true,
 			},
 			Logger: logger.Default.LogMode(logger.Info),
 		}
-	} else {
-		gormConfig = &gorm.Config{
-			PrepareStmt: true,
-			NamingStrategy: schema.NamingStrategy{
-				SingularTable: true,
-			},
-			Logger: nil,
+	}
+	return &gorm.Config{
+		PrepareStmt: true,
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+		Logger: nil,
+	}
+}
+
+// NewClient connect to the database of config.Conf.DatabaseDriver, postgres or sqlite, the auto migration
+// apply the migrations of sources.
+func NewClient(conf *config.Config, sources ...fs.FS) (HandlerDatabase, error) {
+	switch driver := conf.DatabaseDriver(); driver {
+	case config.DriverPostgres:
+		return NewDatabaseClient(conf, sources...)
+	case config.DriverSQLite:
+		return NewSQLiteClient(conf, sources...)
+	default:
+		return HandlerDatabase{}, fmt.Errorf("database driver %q has no sql database, use %s or %s", driver, config.DriverPostgres, config.DriverSQLite)
+	}
+}
+
+// Connect connect to the database of conf.DatabaseDriver, retrying with the backoff of conf.Startup.Retry.
+// In degraded mode a postgres still down after the retries is returned not ready: its pool is open,
+// the queries fail until the database answer, and it is connected then migrated in the background.
+func Connect(ctx context.Context, conf *config.Config, degraded bool, sources ...fs.FS) (HandlerDatabase, error) {
+	driver := conf.DatabaseDriver()
+	backoff := retry.NewBackoff(conf.Startup.Retry)
+
+	var db HandlerDatabase
+	err := retry.Do(ctx, backoff, "connect to database "+driver, func(ctx context.Context) (err error) {
+		db, err = NewClient(conf, sources...)
+		return err
+	})
+	if err == nil {
+		db.State = retry.NewState("database "+driver, true)
+		return db, nil
+	}
+	if !degraded || driver != config.DriverPostgres {
+		return HandlerDatabase{}, err
+	}
+
+	dbConn, errOpen := openPsqlDb(conf, postgresDSN(conf.Postgres, conf.Postgres.Host, conf.Postgres.Port, conf.Postgres.User, conf.Postgres.Password))
+	if errOpen != nil {
+		return HandlerDatabase{}, errOpen
+	}
+	var replicas *ReplicaSet
+	if len(conf.Postgres.Replica.Hosts) > 0 {
+		if replicas, errOpen = NewReplicaSet(conf); errOpen != nil {
+			closeConn(dbConn)
+			return HandlerDatabase{}, errOpen
 		}
 	}
 
-	return gorm.Open(postgres.New(postgres.Config{
-		Conn: conn,
-	}), gormConfig)
+	state := retry.NewState("database "+driver, false)
+	state.MarkDown(err)
+	log.Printf("database %s is not reachable, starting in degraded mode: %v", driver, err)
+	reconnectCtx, stopReconnect := context.WithCancel(context.Background())
+	go reconnect(reconnectCtx, conf, dbConn, sources, state, backoff.Forever())
+
+	return HandlerDatabase{
+		DbConn:        dbConn,
+		Replicas:      replicas,
+		State:         state,
+		stopReconnect: stopReconnect,
+	}, nil
+}
+
+// StopReconnect stop the reconnection in the background of a database down at boot.
+func (h HandlerDatabase) StopReconnect() {
+	if h.stopReconnect != nil {
+		h.stopReconnect()
+	}
+}
+
+// reconnect wait for the database of dbConn to answer, apply the migrations when enabled, then mark it ready.
+// It give up when ctx is canceled.
+func reconnect(ctx context.Context, conf *config.Config, dbConn *gorm.DB, sources []fs.FS, state *retry.State, backoff retry.Backoff) {
+	err := retry.Do(ctx, backoff, "reconnect to database", func(ctx context.Context) error {
+		sqlDB, err := dbConn.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+		if err == nil && conf.Postgres.AutoMigrate {
+			err = migrate(dbConn, sources)
+		}
+		if err != nil {
+			state.MarkDown(err)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+	state.MarkReady()
+}
+
+// migrate apply the pending schema migrations of sources.
+func migrate(dbConn *gorm.DB, sources []fs.FS) error {
+	migrator, err := NewMigrator(dbConn, sources...)
+	if err != nil {
+		log.Printf("failed to read migrations: %v", err)
+		return err
+	}
+	if err = migrator.Up(context.Background()); err != nil {
+		log.Printf("failed to migrate database: %v", err)
+		return err
+	}
+	return nil
 }
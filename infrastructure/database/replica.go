@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	defaultReplicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+type primaryKey struct{}
+
+// WithPrimary mark ctx so its reads are served by the primary, used for read-your-writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// ReplicaStatus is the state of a read replica after its last health check.
+type ReplicaStatus struct {
+	Name      string        `json:"name"`
+	Healthy   bool          `json:"healthy"`
+	Lag       time.Duration `json:"lag"`
+	LastError string        `json:"lastError,omitempty"`
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+	checked atomic.Bool
+
+	mu     sync.Mutex
+	status ReplicaStatus
+}
+
+// ReplicaSet spread the reads over the healthy read replicas of postgres, round robin.
+type ReplicaSet struct {
+	replicas      []*replica
+	next          atomic.Uint64
+	checkInterval time.Duration
+	maxLag        time.Duration
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+// NewReplicaSet open the replicas of conf.Postgres.Replica and start checking their health,
+// a replica down at boot is ejected until it answers.
+func NewReplicaSet(conf *config.Config) (*ReplicaSet, error) {
+	set := &ReplicaSet{
+		checkInterval: conf.Postgres.Replica.CheckInterval,
+		maxLag:        conf.Postgres.Replica.MaxLag,
+		stop:          make(chan struct{}),
+	}
+	if set.checkInterval <= 0 {
+		set.checkInterval = defaultReplicaCheckInterval
+	}
+
+	for _, host := range conf.Postgres.Replica.Hosts {
+		user, password := host.User, host.Password
+		if user == "" {
+			user, password = conf.Postgres.User, conf.Postgres.Password
+		}
+		// the pool is opened without connecting, unlike the primary a replica may be down at boot
+		db, err := openPsqlDb(conf, postgresDSN(conf.Postgres, host.Host, host.Port, user, password))
+		if err != nil {
+			_ = set.Close()
+			return nil, err
+		}
+		name := fmt.Sprintf("%s:%s", host.Host, host.Port)
+		set.replicas = append(set.replicas, &replica{
+			name:   name,
+			db:     db,
+			status: ReplicaStatus{Name: name},
+		})
+	}
+
+	set.checkAll()
+	go set.checkLoop()
+	return set, nil
+}
+
+// Reader return the connection for a read: the transaction of ctx if any, the primary when ctx
+// asked for it or no replica is healthy, a healthy replica otherwise.
+func (s *ReplicaSet) Reader(ctx context.Context, primary *gorm.DB) *gorm.DB {
+	if s == nil || usePrimary(ctx) || ctx.Value(gormTxKey{}) != nil {
+		return Conn(ctx, primary)
+	}
+
+	count := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < count; i++ {
+		candidate := s.replicas[(start+i)%count]
+		if candidate.healthy.Load() {
+			return candidate.db.WithContext(ctx)
+		}
+	}
+	return Conn(ctx, primary)
+}
+
+// Status return the state of every replica.
+func (s *ReplicaSet) Status() []ReplicaStatus {
+	if s == nil {
+		return nil
+	}
+	result := make([]ReplicaStatus, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		r.mu.Lock()
+		result = append(result, r.status)
+		r.mu.Unlock()
+	}
+	return result
+}
+
+// DBs return the connection of every replica by name.
+func (s *ReplicaSet) DBs() map[string]*gorm.DB {
+	if s == nil {
+		return nil
+	}
+	dbs := make(map[string]*gorm.DB, len(s.replicas))
+	for _, r := range s.replicas {
+		dbs[r.name] = r.db
+	}
+	return dbs
+}
+
+// Close stop the health checks and close every replica.
+func (s *ReplicaSet) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	var errs []error
+	for _, r := range s.replicas {
+		sqlDB, err := r.db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ReplicaSet) checkLoop() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkAll()
+		}
+	}
+}
+
+func (s *ReplicaSet) checkAll() {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			s.check(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check ping the replica and measure its replication lag, the replica is ejected
+// when it doesn't answer or lag more than maxLag.
+func (s *ReplicaSet) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+
+	// a replica which replayed everything it received is not lagging even if the primary is idle,
+	// the replay timestamp is null on a replica which didn't replay anything yet
+	var lagSeconds sql.NullFloat64
+	err := r.db.Session(&gorm.Session{Context: ctx, Logger: logger.Discard}).
+		Raw(`select case when pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() then 0
+			else extract(epoch from now() - pg_last_xact_replay_timestamp()) end`).
+		Scan(&lagSeconds).
+		Error
+	lag := time.Duration(lagSeconds.Float64 * float64(time.Second))
+	if err == nil && s.maxLag > 0 && lag > s.maxLag {
+		err = fmt.Errorf("replication lag %s is over %s", lag, s.maxLag)
+	}
+
+	healthy := err == nil
+	firstCheck := !r.checked.Swap(true)
+	if r.healthy.Swap(healthy) != healthy || (firstCheck && !healthy) {
+		if healthy {
+			log.Infof("read replica %s is healthy, it serves reads again", r.name)
+		} else {
+			log.Warnf("read replica %s is ejected: %v", r.name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Healthy = healthy
+	r.status.Lag = lag
+	r.status.LastError = ""
+	if err != nil {
+		r.status.LastError = err.Error()
+	}
+}
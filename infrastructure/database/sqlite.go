@@ -0,0 +1,58 @@
+package database
+
+import (
+	"io/fs"
+	"log"
+	"net/url"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const sqliteInMemoryPath = ":memory:"
+
+// sqlitePragmas wait for the lock instead of failing with SQLITE_BUSY
+// when another process write in the same file.
+var sqlitePragmas = []string{
+	"busy_timeout(5000)",
+	"foreign_keys(1)",
+}
+
+// NewSQLiteClient open the embedded sqlite database at conf.Database.SQLite.Path,
+// the file is created when it doesn't exist. The auto migration apply the migrations of sources.
+func NewSQLiteClient(conf *config.Config, sources ...fs.FS) (HandlerDatabase, error) {
+	path := conf.Database.SQLite.Path
+	if path == "" {
+		path = sqliteInMemoryPath
+	}
+
+	query := url.Values{}
+	for _, pragma := range sqlitePragmas {
+		query.Add("_pragma", pragma)
+	}
+	dbConn, err := gorm.Open(sqlite.Open(path+"?"+query.Encode()), newGormConfig(conf.LogMode))
+	if err != nil {
+		log.Printf("failed to open sqlite database %s: %v", path, err)
+		return HandlerDatabase{}, err
+	}
+
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		return HandlerDatabase{}, err
+	}
+	// sqlite has a single writer, and every connection to :memory: is a different database
+	sqlDB.SetMaxOpenConns(1)
+
+	//apply the pending schema migrations on boot when enabled
+	if conf.Database.SQLite.AutoMigrate {
+		if err = migrate(dbConn, sources); err != nil {
+			return HandlerDatabase{}, err
+		}
+	}
+
+	return HandlerDatabase{
+		DbConn: dbConn,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Transactor run a unit of work: every repository call made with the ctx given to fn
+// is committed when fn return nil and rolled back when it return an error or panic.
+// A nested call run inside the unit of work of ctx and only roll back its own changes (a savepoint).
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type gormTxKey struct{}
+
+type undoLogKey struct{}
+
+// GormTransactor run the unit of work in a gorm transaction, nested units of work are savepoints.
+type GormTransactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) *GormTransactor {
+	return &GormTransactor{
+		db: db,
+	}
+}
+
+func (t *GormTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	db := t.db.WithContext(ctx)
+	if tx, ok := ctx.Value(gormTxKey{}).(*gorm.DB); ok {
+		// gorm run Transaction on a transaction as a savepoint
+		db = tx
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, gormTxKey{}, tx))
+	})
+}
+
+// Conn return the transaction of the unit of work of ctx, or db outside of a unit of work.
+// Repositories use it instead of db.WithContext so their queries join the unit of work.
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(gormTxKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// InMemoryTransactor run the unit of work over the in-memory stores, which apply every change
+// right away and register how to undo it with OnRollback. Units of work are run one at a time,
+// the changes are visible to the other readers before the commit.
+type InMemoryTransactor struct {
+	mu sync.Mutex
+}
+
+func NewInMemoryTransactor() *InMemoryTransactor {
+	return &InMemoryTransactor{}
+}
+
+// undoLog is the list of undo of a unit of work, applied in reverse order on rollback.
+type undoLog struct {
+	mu      sync.Mutex
+	entries []func() error
+}
+
+func (l *undoLog) add(undo ...func() error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, undo...)
+}
+
+func (l *undoLog) rollback() error {
+	l.mu.Lock()
+	entries := l.entries
+	l.entries = nil
+	l.mu.Unlock()
+
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := entries[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *InMemoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	parent, nested := ctx.Value(undoLogKey{}).(*undoLog)
+	if !nested {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+	}
+
+	log := &undoLog{}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = log.rollback()
+			panic(p)
+		}
+		if err != nil {
+			if errRollback := log.rollback(); errRollback != nil {
+				err = fmt.Errorf("%w, rollback failed: %v", err, errRollback)
+			}
+			return
+		}
+		// the savepoint is released, its changes are undone with the parent
+		if nested {
+			parent.add(log.entries...)
+		}
+	}()
+
+	return fn(context.WithValue(ctx, undoLogKey{}, log))
+}
+
+// InUnitOfWork return true when ctx is in an in-memory unit of work.
+func InUnitOfWork(ctx context.Context) bool {
+	_, ok := ctx.Value(undoLogKey{}).(*undoLog)
+	return ok
+}
+
+// OnRollback register undo to run when the in-memory unit of work of ctx is rolled back,
+// it return false outside of a unit of work.
+func OnRollback(ctx context.Context, undo func() error) bool {
+	log, ok := ctx.Value(undoLogKey{}).(*undoLog)
+	if !ok {
+		return false
+	}
+	log.add(undo)
+	return true
+}
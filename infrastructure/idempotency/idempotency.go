@@ -0,0 +1,155 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/redis"
+)
+
+// Record is the state stored for an idempotency key, while the first request
+// is still executed Completed is false and only Fingerprint is filled.
+type Record struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// Store keep the idempotency records.
+type Store interface {
+	// Reserve mark the key as in flight for the given fingerprint until ttl, the time of the execution.
+	// When the key is already used it returns the existing record and false.
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (record Record, reserved bool, err error)
+	// Complete save the response of the first execution, so it can be replayed.
+	Complete(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release drop the key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// maxReserveAttempts bound the reservations of a key expiring between the reservation and its read
+const maxReserveAttempts = 3
+
+type redisStore struct {
+	redisLib redis.LibInterface
+}
+
+// NewRedisStore creates a Store backed by redis, shared by every replica.
+func NewRedisStore(redisLib redis.LibInterface) Store {
+	return &redisStore{
+		redisLib: redisLib,
+	}
+}
+
+func (s *redisStore) Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (Record, bool, error) {
+	inFlight, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.redisLib.SetIdempotencyKey(ctx, key, inFlight, ttl)
+		if err == nil {
+			return Record{}, true, nil
+		}
+		if !errors.Is(err, redis.ErrMultipleKeyInCache) {
+			return Record{}, false, err
+		}
+
+		var existing Record
+		value, err := s.redisLib.Get(ctx, key)
+		if err != nil {
+			return Record{}, false, err
+		}
+		if value == "" {
+			// the key expired or was released in between, reserve it again
+			if attempt < maxReserveAttempts {
+				continue
+			}
+			return Record{}, false, errors.New("idempotency key keeps expiring while reserved")
+		}
+		if err = json.Unmarshal([]byte(value), &existing); err != nil {
+			return Record{}, false, err
+		}
+		return existing, false, nil
+	}
+}
+
+func (s *redisStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	record.Completed = true
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.redisLib.Set(ctx, key, value, ttl)
+}
+
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	return s.redisLib.DeleteKey(ctx, key)
+}
+
+type inMemoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+type inMemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]inMemoryEntry
+}
+
+// NewInMemoryStore creates a Store local to the process, used when redis is disabled.
+func NewInMemoryStore() Store {
+	return &inMemoryStore{
+		entries: make(map[string]inMemoryEntry),
+	}
+}
+
+func (s *inMemoryStore) Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evictExpired(now)
+
+	if entry, ok := s.entries[key]; ok {
+		return entry.record, false, nil
+	}
+	s.entries[key] = inMemoryEntry{
+		record:    Record{Fingerprint: fingerprint},
+		expiresAt: now.Add(ttl),
+	}
+	return Record{}, true, nil
+}
+
+func (s *inMemoryStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Completed = true
+	s.entries[key] = inMemoryEntry{
+		record:    record,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *inMemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *inMemoryStore) evictExpired(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
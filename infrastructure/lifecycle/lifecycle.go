@@ -0,0 +1,216 @@
+// Package lifecycle start and stop the components of the server in order: on shutdown the traffic
+// is drained first, then the background jobs are stopped, the data flushed and the connections closed.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The priorities of the hooks, they are stopped from the lowest to the highest and started the other way.
+const (
+	// PriorityServer stop accepting traffic and drain the requests in flight
+	PriorityServer = 0
+	// PriorityBackground stop the background jobs, like the config watcher, the snapshot loop and the reconnections
+	PriorityBackground = 100
+	// PriorityFlush write what is still in memory, like the snapshot and the spans
+	PriorityFlush = 200
+	// PriorityClose close the connections to the database and redis
+	PriorityClose = 300
+	// PriorityLogs flush and close the log sinks, the last to stop so every hook can log
+	PriorityLogs = 400
+)
+
+// defaultStopTimeout bound OnStop of the hooks without Timeout
+const defaultStopTimeout = 5 * time.Second
+
+// Hook is a component started and stopped by the manager, OnStart and OnStop are optional.
+// OnStop is given Timeout, 5s when zero, a hook overrunning it doesn't delay the next ones of
+// its priority, but the next priorities wait for it as long again since they may close what it uses.
+type Hook struct {
+	Name     string
+	Priority int
+	Timeout  time.Duration
+	OnStart  func(ctx context.Context) error
+	OnStop   func(ctx context.Context) error
+}
+
+// Manager run the hooks of the components, the hooks of the same priority are stopped in the
+// reverse order of their registration.
+type Manager struct {
+	mu      sync.Mutex
+	hooks   []*Hook
+	started map[*Hook]bool
+	stopped bool
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		started: map[*Hook]bool{},
+	}
+}
+
+// Append register hook, it must be done before Start.
+func (m *Manager) Append(hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, &hook)
+}
+
+// Start run OnStart from the highest priority to the lowest, when one fail the hooks already
+// started are stopped and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.stopOrder()
+	m.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				err = fmt.Errorf("start %s: %w", hook.Name, err)
+				if stopErr := m.Stop(ctx); stopErr != nil {
+					err = errors.Join(err, stopErr)
+				}
+				return err
+			}
+		}
+		m.mu.Lock()
+		m.started[hook] = true
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop run OnStop of the started hooks from the lowest priority to the highest, it is done once.
+// A failing hook doesn't stop the next ones, the hooks failing or overrunning their timeout are
+// logged and returned in the error. The hooks after a hook still running once its timeout is
+// overrun twice are skipped, like the connections a flush still write to.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	hooks := m.stopOrder()
+	started := m.started
+	m.mu.Unlock()
+
+	var errs []error
+	var running []overrunHook
+	for i, hook := range hooks {
+		if hook.OnStop == nil || !started[hook] {
+			continue
+		}
+		if len(running) > 0 && hook.Priority != running[len(running)-1].Priority {
+			if err := waitOverrun(ctx, running); err != nil {
+				err = fmt.Errorf("stop of %s skipped: %w", strings.Join(hookNames(hooks[i:], started), ", "), err)
+				log.Errorf("shutdown: %v", err)
+				return errors.Join(append(errs, err)...)
+			}
+			running = nil
+		}
+		done, err := stopHook(ctx, hook)
+		if err != nil {
+			log.Errorf("shutdown: %v", err)
+			errs = append(errs, err)
+		}
+		if done != nil {
+			running = append(running, overrunHook{Hook: hook, done: done})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// overrunHook is a hook still running after its timeout, done is closed once OnStop return.
+type overrunHook struct {
+	*Hook
+	done <-chan struct{}
+}
+
+// waitOverrun wait for the hooks of running as long again as their timeout, it return an error
+// naming the first one still running after.
+func waitOverrun(ctx context.Context, running []overrunHook) error {
+	for _, hook := range running {
+		timer := time.NewTimer(stopTimeout(hook.Hook))
+		select {
+		case <-hook.done:
+			timer.Stop()
+			log.Infof("shutdown: %s stopped after its timeout", hook.Name)
+		case <-timer.C:
+			return fmt.Errorf("%s is still running", hook.Name)
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s is still running: %w", hook.Name, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// hookNames return the name of the hooks which have to be stopped.
+func hookNames(hooks []*Hook, started map[*Hook]bool) []string {
+	var names []string
+	for _, hook := range hooks {
+		if hook.OnStop != nil && started[hook] {
+			names = append(names, hook.Name)
+		}
+	}
+	return names
+}
+
+// stopOrder return the hooks sorted by priority, the last registered first within a priority,
+// it must be called with mu held.
+func (m *Manager) stopOrder() []*Hook {
+	hooks := make([]*Hook, len(m.hooks))
+	for i, hook := range m.hooks {
+		hooks[len(hooks)-1-i] = hook
+	}
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Priority < hooks[j].Priority
+	})
+	return hooks
+}
+
+func stopTimeout(hook *Hook) time.Duration {
+	if hook.Timeout <= 0 {
+		return defaultStopTimeout
+	}
+	return hook.Timeout
+}
+
+// stopHook run OnStop of hook for its timeout, when it overrun the returned channel is closed
+// once OnStop return.
+func stopHook(ctx context.Context, hook *Hook) (<-chan struct{}, error) {
+	timeout := stopTimeout(hook)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	start := time.Now()
+	result := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		result <- hook.OnStop(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		took := time.Since(start)
+		if err != nil {
+			return nil, fmt.Errorf("stop %s failed after %s: %w", hook.Name, took.Round(time.Millisecond), err)
+		}
+		log.Infof("shutdown: %s stopped in %s", hook.Name, took.Round(time.Millisecond))
+		return nil, nil
+	case <-ctx.Done():
+		//the hook keep running, the next ones of its priority still get a chance to stop
+		return done, fmt.Errorf("stop %s overran its timeout of %s: %w", hook.Name, timeout, ctx.Err())
+	}
+}
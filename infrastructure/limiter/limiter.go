@@ -1,55 +1,127 @@
 package limiter
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTokensExhausted is returned by Check while every request is rejected.
+var ErrTokensExhausted = errors.New("rate limiter has no token left, requests are rejected")
 
 type RateLimiter struct {
+	mu         sync.RWMutex
 	rate       int           // Number of actions allowed per time window
 	interval   time.Duration // Time window duration
 	tokenCount int           // Available tokens at the moment
 	tokens     chan struct{} // Channel to hold tokens
+	lastRefill atomic.Int64  // Unix nano time of the last refill
+	updated    chan struct{} // Signal the refill of a new rate or interval
 }
 
 func NewRateLimiter(rate int, interval time.Duration) *RateLimiter {
-	if rate == 0 {
-		rate = 1
-	}
-
-	if interval == 0 {
-		interval = time.Second
-	}
+	rate, interval = limiterParameters(rate, interval)
 
 	limiter := &RateLimiter{
 		rate:       rate,
 		interval:   interval,
 		tokenCount: rate,
 		tokens:     make(chan struct{}, rate),
+		updated:    make(chan struct{}, 1),
 	}
 
+	limiter.lastRefill.Store(time.Now().UnixNano())
 	go limiter.refillTokens()
 
 	return limiter
 }
 
+func limiterParameters(rate int, interval time.Duration) (int, time.Duration) {
+	if rate == 0 {
+		rate = 1
+	}
+
+	if interval == 0 {
+		interval = time.Second
+	}
+	return rate, interval
+}
+
+// Update change the rate and the interval without restart, the tokens left are kept up to the new rate.
+func (limiter *RateLimiter) Update(rate int, interval time.Duration) {
+	rate, interval = limiterParameters(rate, interval)
+
+	limiter.mu.Lock()
+	tokens := make(chan struct{}, rate)
+	for len(tokens) < rate && len(limiter.tokens) > 0 {
+		<-limiter.tokens
+		tokens <- struct{}{}
+	}
+	limiter.rate = rate
+	limiter.interval = interval
+	limiter.tokenCount = rate
+	limiter.tokens = tokens
+	limiter.mu.Unlock()
+
+	select {
+	case limiter.updated <- struct{}{}:
+	default:
+		//a refill is already signaled
+	}
+}
+
+func (limiter *RateLimiter) parameters() (int, time.Duration, chan struct{}) {
+	limiter.mu.RLock()
+	defer limiter.mu.RUnlock()
+	return limiter.rate, limiter.interval, limiter.tokens
+}
+
 func (limiter *RateLimiter) refillTokens() {
 	for {
+		rate, interval, tokens := limiter.parameters()
 		select {
-		case <-time.After(limiter.interval / time.Duration(limiter.rate)):
-			for i := 0; i < limiter.rate; i++ {
+		case <-time.After(interval / time.Duration(rate)):
+			for i := 0; i < rate; i++ {
 				select {
-				case limiter.tokens <- struct{}{}:
+				case tokens <- struct{}{}:
 				default:
 					//just next the request, don't block it
 				}
 			}
+			limiter.lastRefill.Store(time.Now().UnixNano())
+		case <-limiter.updated:
+			//wait with the new rate and interval
 		}
 	}
 }
 
 func (limiter *RateLimiter) Allow() bool {
+	_, _, tokens := limiter.parameters()
 	select {
-	case <-limiter.tokens:
+	case <-tokens:
 		return true
 	default:
 		return false
 	}
 }
+
+// Available return the number of tokens left.
+func (limiter *RateLimiter) Available() int {
+	_, _, tokens := limiter.parameters()
+	return len(tokens)
+}
+
+// Check return an error when the tokens are not refilled anymore or are all taken.
+func (limiter *RateLimiter) Check() error {
+	_, interval, _ := limiter.parameters()
+	sinceRefill := time.Since(time.Unix(0, limiter.lastRefill.Load()))
+	if sinceRefill > 2*interval+time.Second {
+		return fmt.Errorf("rate limiter tokens are not refilled since %s", sinceRefill.Round(time.Millisecond))
+	}
+	if limiter.Available() == 0 {
+		return ErrTokensExhausted
+	}
+	return nil
+}
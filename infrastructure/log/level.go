@@ -0,0 +1,161 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Levels is the log levels in use, the base level of every context and the level of the contexts overridden.
+// An override on "service" apply to "service.GetListArticle", the longest matching override win.
+type Levels struct {
+	Level      string            `json:"level"`
+	Overrides  map[string]string `json:"overrides"`
+	DebugUntil *time.Time        `json:"debugUntil,omitempty"`
+}
+
+type levelState struct {
+	mu         sync.RWMutex
+	base       log.Level
+	overrides  map[string]log.Level
+	debugUntil time.Time
+	debugTimer *time.Timer
+}
+
+var (
+	levels = &levelState{
+		base:      log.InfoLevel,
+		overrides: map[string]log.Level{},
+	}
+
+	// contextLogger write the entries of Info, Warn, Debug and Error, their level is checked
+	// against the level of the context before, so it accept every level.
+	contextLogger = log.New()
+)
+
+func parseLevel(level string) (log.Level, error) {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return lvl, fmt.Errorf("log level %q is not valid, use one of error|warn|info|debug", level)
+	}
+	return lvl, nil
+}
+
+// SetLevels replace the base level and the overrides, nothing is changed when one of the levels is not valid.
+func SetLevels(level string, overrides map[string]string) error {
+	base, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	parsed := make(map[string]log.Level, len(overrides))
+	for ctxName, override := range overrides {
+		lvl, err := parseLevel(override)
+		if err != nil {
+			return fmt.Errorf("context %s: %w", ctxName, err)
+		}
+		parsed[ctxName] = lvl
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.base = base
+	levels.overrides = parsed
+	levels.apply()
+	return nil
+}
+
+// SetOverride set the level of the context ctxName and the contexts under it.
+func SetOverride(ctxName, level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.overrides[ctxName] = lvl
+	return nil
+}
+
+// RemoveOverride put back the context ctxName on the base level.
+func RemoveOverride(ctxName string) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	delete(levels.overrides, ctxName)
+}
+
+// DebugFor log every context at debug level for d, then revert to the levels set, a new window replace
+// the running one and a zero d end it.
+func DebugFor(d time.Duration) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if levels.debugTimer != nil {
+		levels.debugTimer.Stop()
+		levels.debugTimer = nil
+	}
+	levels.debugUntil = time.Time{}
+	if d > 0 {
+		levels.debugUntil = time.Now().Add(d)
+		levels.debugTimer = time.AfterFunc(d, endDebug)
+		log.Warnf("debug logs enabled until %s", levels.debugUntil.Format(time.RFC3339))
+	}
+	levels.apply()
+}
+
+func endDebug() {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.debugUntil = time.Time{}
+	levels.debugTimer = nil
+	levels.apply()
+	log.Warn("debug logs window ended, levels reverted")
+}
+
+// CurrentLevels return the levels in use.
+func CurrentLevels() Levels {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	current := Levels{
+		Level:     levels.base.String(),
+		Overrides: make(map[string]string, len(levels.overrides)),
+	}
+	for ctxName, lvl := range levels.overrides {
+		current.Overrides[ctxName] = lvl.String()
+	}
+	if !levels.debugUntil.IsZero() {
+		debugUntil := levels.debugUntil
+		current.DebugUntil = &debugUntil
+	}
+	return current
+}
+
+// apply set the level of the logrus logger, used outside of the contexts, it must be called with mu held.
+func (s *levelState) apply() {
+	if !s.debugUntil.IsZero() {
+		log.SetLevel(log.DebugLevel)
+		return
+	}
+	log.SetLevel(s.base)
+}
+
+// enabled return true when an entry of level is logged for the context ctxName.
+func enabled(ctxName string, level log.Level) bool {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	if !levels.debugUntil.IsZero() && level <= log.DebugLevel {
+		return true
+	}
+	lvl, matched := levels.base, -1
+	for prefix, override := range levels.overrides {
+		if len(prefix) > matched && (ctxName == prefix || strings.HasPrefix(ctxName, prefix+".")) {
+			lvl, matched = override, len(prefix)
+		}
+	}
+	return level <= lvl
+}
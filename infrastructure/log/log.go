@@ -2,57 +2,79 @@ package log
 
 import (
 	"context"
-	"os"
-	"strings"
+
+	"go-gin-gorm-example/infrastructure/config"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const CorrelationID string = "X-Correlation-ID"
 
-func Init(logFormat, logLevel string) {
-	switch strings.ToLower(logFormat) {
-	case "json":
-		log.SetFormatter(&log.JSONFormatter{})
-	default:
-		log.SetFormatter(&log.TextFormatter{
-			FullTimestamp: true,
-		})
-	}
-	switch strings.ToLower(logLevel) {
-	case "info":
-		log.SetLevel(log.InfoLevel)
-	case "warn":
-		log.SetLevel(log.WarnLevel)
-	case "error":
-		log.SetLevel(log.ErrorLevel)
-	case "debug":
-		log.SetLevel(log.DebugLevel)
-	default:
-		log.SetLevel(log.InfoLevel)
-	}
-	log.SetOutput(os.Stdout)
+// Init configure the sinks and the levels of the logs of conf, an unknown level fallback to info and an
+// unknown level of the overrides, the level by context, is ignored.
+func Init(conf config.Config) error {
+	sinks, err := openSinks(conf)
+	if err != nil {
+		return err
+	}
+	if err = installSinks(sinks); err != nil {
+		log.Warnf("failed close the previous log sinks: %v", err)
+	}
+	contextLogger.SetLevel(log.TraceLevel)
+
+	logLevel, overrides := conf.LogLevel, conf.LogLevelOverrides()
+	if _, err := parseLevel(logLevel); err != nil {
+		logLevel = log.InfoLevel.String()
+	}
+	valid := make(map[string]string, len(overrides))
+	for ctxName, level := range overrides {
+		if _, err := parseLevel(level); err != nil {
+			log.Warnf("ignored log level of %s: %v", ctxName, err)
+			continue
+		}
+		valid[ctxName] = level
+	}
+	return SetLevels(logLevel, valid)
 }
 
 func getEntry(ctx context.Context, ctxName string) *log.Entry {
-	return log.WithFields(log.Fields{
+	fields := log.Fields{
 		"context":       ctxName,
 		"correlationId": ctx.Value(CorrelationID),
-	})
+	}
+	//link the entry to the trace of the request
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields["traceId"] = spanContext.TraceID().String()
+		fields["spanId"] = spanContext.SpanID().String()
+	}
+	return contextLogger.WithFields(fields)
 }
 
 func Info(ctx context.Context, ctxName string, format string, args ...interface{}) {
+	if !enabled(ctxName, log.InfoLevel) {
+		return
+	}
 	getEntry(ctx, ctxName).Infof(format, args...)
 }
 
 func Warn(ctx context.Context, ctxName string, format string, args ...interface{}) {
+	if !enabled(ctxName, log.WarnLevel) {
+		return
+	}
 	getEntry(ctx, ctxName).Warnf(format, args...)
 }
 
 func Debug(ctx context.Context, ctxName string, format string, args ...interface{}) {
+	if !enabled(ctxName, log.DebugLevel) {
+		return
+	}
 	getEntry(ctx, ctxName).Debugf(format, args...)
 }
 
 func Error(ctx context.Context, ctxName string, format string, args ...interface{}) {
+	if !enabled(ctxName, log.ErrorLevel) {
+		return
+	}
 	getEntry(ctx, ctxName).Errorf(format, args...)
 }
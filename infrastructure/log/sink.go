@@ -0,0 +1,268 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+
+	defaultLogFile      = "app.log"
+	defaultLogFileSize  = 100
+	defaultSyslogTag    = "go-gin-gorm-example"
+	formatJSON          = "json"
+	levelAll            = log.TraceLevel
+	sinkWriteErrorTitle = "failed write log entry to sink"
+)
+
+// sinkWriter write the formatted entries, a syslog writer use the level for the priority.
+type sinkWriter interface {
+	write(level log.Level, line []byte) error
+	Close() error
+}
+
+// sink write the entries up to its level, with its own format.
+type sink struct {
+	mu        sync.Mutex
+	name      string
+	level     log.Level
+	formatter log.Formatter
+	writer    sinkWriter
+}
+
+// sinkHook fire the entries of the loggers to every sink, the loggers themselves discard them.
+type sinkHook struct {
+	sinks []*sink
+	// fallback get the entries logged after Close, stderr when no sink write to stdout
+	fallback io.Writer
+}
+
+var (
+	sinksMu sync.Mutex
+	hook    *sinkHook
+)
+
+func (h *sinkHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *sinkHook) Fire(entry *log.Entry) error {
+	for _, s := range h.sinks {
+		if entry.Level > s.level {
+			continue
+		}
+		line, err := s.formatter.Format(entry)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		err = s.writer.write(entry.Level, line)
+		s.mu.Unlock()
+		if err != nil {
+			//the entry is not lost for the other sinks, the error is written where it can
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", sinkWriteErrorTitle, s.name, err)
+		}
+	}
+	return nil
+}
+
+// sinksConfig return the sinks of conf, stdout in logFormat when none is configured.
+func sinksConfig(conf config.Config) []config.LogSinkConfig {
+	if len(conf.LogSinks) == 0 {
+		return []config.LogSinkConfig{{Type: SinkStdout, Format: conf.LogFormat}}
+	}
+	return conf.LogSinks
+}
+
+func openSinks(conf config.Config) ([]*sink, error) {
+	var sinks []*sink
+	for i, sinkConf := range sinksConfig(conf) {
+		s, err := openSink(sinkConf)
+		if err != nil {
+			_ = closeSinks(sinks)
+			return nil, fmt.Errorf("log sink %d (%s): %w", i, sinkConf.Type, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func openSink(conf config.LogSinkConfig) (*sink, error) {
+	level := levelAll
+	if conf.Level != "" {
+		var err error
+		if level, err = parseLevel(conf.Level); err != nil {
+			return nil, err
+		}
+	}
+
+	var writer sinkWriter
+	var err error
+	typ := strings.ToLower(conf.Type)
+	switch typ {
+	case SinkStdout, "":
+		typ = SinkStdout
+		writer = streamWriter{Writer: os.Stdout}
+	case SinkStderr:
+		writer = streamWriter{Writer: os.Stderr}
+	case SinkFile:
+		writer = newFileWriter(conf.File)
+	case SinkSyslog:
+		writer, err = newSyslogWriter(conf.Syslog)
+	default:
+		err = fmt.Errorf("type is not supported, use one of %s|%s|%s|%s", SinkStdout, SinkStderr, SinkFile, SinkSyslog)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sink{
+		name:      typ,
+		level:     level,
+		formatter: newFormatter(conf.Format, typ),
+		writer:    writer,
+	}, nil
+}
+
+// WithoutStdout return conf with the stdout sinks, or the default one, writing to stderr.
+func WithoutStdout(conf config.Config) config.Config {
+	sinks := sinksConfig(conf)
+	conf.LogSinks = make([]config.LogSinkConfig, len(sinks))
+	for i, sink := range sinks {
+		if t := strings.ToLower(sink.Type); t == SinkStdout || t == "" {
+			sink.Type = SinkStderr
+		}
+		conf.LogSinks[i] = sink
+	}
+	return conf
+}
+
+func newFormatter(format, typ string) log.Formatter {
+	if strings.ToLower(format) == formatJSON {
+		return &log.JSONFormatter{}
+	}
+	return &log.TextFormatter{
+		FullTimestamp: true,
+		//the colors are for a terminal and syslog put its own timestamp
+		DisableColors:    typ != SinkStdout && typ != SinkStderr,
+		DisableTimestamp: typ == SinkSyslog,
+	}
+}
+
+// streamWriter write to stdout or stderr, it is not closed.
+type streamWriter struct {
+	io.Writer
+}
+
+func (w streamWriter) write(_ log.Level, line []byte) error {
+	_, err := w.Write(line)
+	return err
+}
+
+func (w streamWriter) Close() error {
+	return nil
+}
+
+// fileWriter write to a file rotated by size, the old files are removed by age and count.
+type fileWriter struct {
+	*lumberjack.Logger
+}
+
+func newFileWriter(conf config.LogFileConfig) fileWriter {
+	path := conf.Path
+	if path == "" {
+		path = defaultLogFile
+	}
+	maxSize := conf.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultLogFileSize
+	}
+	return fileWriter{Logger: &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxAge:     conf.MaxAgeDays,
+		MaxBackups: conf.MaxBackups,
+		Compress:   conf.Compress,
+		LocalTime:  true,
+	}}
+}
+
+func (w fileWriter) write(_ log.Level, line []byte) error {
+	_, err := w.Write(line)
+	return err
+}
+
+// installSinks write the entries of the loggers to sinks, the sinks installed before are closed.
+func installSinks(sinks []*sink) error {
+	newHook := &sinkHook{sinks: sinks, fallback: os.Stderr}
+	for _, s := range sinks {
+		if s.name == SinkStdout {
+			newHook.fallback = os.Stdout
+		}
+	}
+	for _, logger := range []*log.Logger{log.StandardLogger(), contextLogger} {
+		logger.SetFormatter(discardFormatter{})
+		logger.SetOutput(io.Discard)
+		logger.ReplaceHooks(log.LevelHooks{})
+		logger.AddHook(newHook)
+	}
+
+	sinksMu.Lock()
+	previous := hook
+	hook = newHook
+	sinksMu.Unlock()
+	if previous == nil {
+		return nil
+	}
+	return closeSinks(previous.sinks)
+}
+
+// Close flush and close the sinks, the entries logged after are written to stdout, or to stderr
+// when no sink wrote to stdout.
+func Close() error {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if hook == nil {
+		return nil
+	}
+	for _, logger := range []*log.Logger{log.StandardLogger(), contextLogger} {
+		logger.ReplaceHooks(log.LevelHooks{})
+		logger.SetFormatter(newFormatter("", SinkStdout))
+		logger.SetOutput(hook.fallback)
+	}
+	err := closeSinks(hook.sinks)
+	hook = nil
+	return err
+}
+
+func closeSinks(sinks []*sink) error {
+	var errs []error
+	for _, s := range sinks {
+		s.mu.Lock()
+		if err := s.writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// discardFormatter skip the formatting of the loggers, the sinks format the entries.
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*log.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package log
+
+import (
+	"log/syslog"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// syslogWriter write to syslog with the priority of the level of the entries.
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+func newSyslogWriter(conf config.LogSyslogConfig) (sinkWriter, error) {
+	tag := conf.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	writer, err := syslog.Dial(conf.Network, conf.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogWriter{Writer: writer}, nil
+}
+
+func (w syslogWriter) write(level log.Level, line []byte) error {
+	message := string(line)
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return w.Crit(message)
+	case log.ErrorLevel:
+		return w.Err(message)
+	case log.WarnLevel:
+		return w.Warning(message)
+	case log.InfoLevel:
+		return w.Info(message)
+	default:
+		return w.Debug(message)
+	}
+}
@@ -0,0 +1,11 @@
+package log
+
+import (
+	"errors"
+
+	"go-gin-gorm-example/infrastructure/config"
+)
+
+func newSyslogWriter(config.LogSyslogConfig) (sinkWriter, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "article_api"
+
+// label values of CacheRequests
+const (
+	CacheGet    = "get"
+	CacheSet    = "set"
+	CacheDelete = "delete"
+
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheOK    = "ok"
+	CacheError = "error"
+)
+
+var (
+	// Registry hold the metrics of the service, with the go runtime and process metrics.
+	Registry = prometheus.NewRegistry()
+
+	factory = promauto.With(Registry)
+
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the http requests by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	RateLimiterRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limiter_rejected_total",
+		Help:      "Number of requests rejected by the rate limiter by route template.",
+	}, []string{"route"})
+
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of redis cache requests of the article service by operation (get|set|delete) and result (hit|miss|ok|error).",
+	}, []string{"operation", "result"})
+
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of the gorm queries by database, operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"db", "operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serve the metrics of Registry in the prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveCacheGet count a get of the cache, a hit when the value is found and an error
+// when the cache failed, not a miss.
+func ObserveCacheGet(found bool, err error) {
+	result := CacheMiss
+	switch {
+	case err != nil:
+		result = CacheError
+	case found:
+		result = CacheHit
+	}
+	CacheRequests.WithLabelValues(CacheGet, result).Inc()
+}
+
+// ObserveCacheWrite count a set or delete of the cache.
+func ObserveCacheWrite(operation string, err error) {
+	result := CacheOK
+	if err != nil {
+		result = CacheError
+	}
+	CacheRequests.WithLabelValues(operation, result).Inc()
+}
+
+// InstrumentDB time the queries of db and export the stats of its pool, name is the db label.
+func InstrumentDB(name string, db *gorm.DB) error {
+	if err := db.Use(&gormPlugin{name: name}); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// RegisterGauge export the value returned by value as the gauge name.
+func RegisterGauge(name, help string, value func() float64) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
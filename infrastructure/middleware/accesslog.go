@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+	logger "go-gin-gorm-example/infrastructure/log"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+	// UserContextKey is the gin context key an authentication middleware set the user with
+	UserContextKey = "user"
+	// sampleResolution is the precision of the sampling of the successful requests
+	sampleResolution = 1_000_000
+	// maxCorrelationIDLength is the longest X-Correlation-ID kept from a request
+	maxCorrelationIDLength = 128
+)
+
+// AccessLog log an entry per request with logrus, it also give the request a correlation id,
+// taken from the X-Correlation-ID header or generated, which is in the logs of the request and sent back.
+// A header too long or with other characters than letters, digits, '-', '_' and '.' is replaced.
+// Its settings change without restart with Update.
+type AccessLog struct {
+	settings atomic.Pointer[accessLogSettings]
+}
+
+type accessLogSettings struct {
+	conf          config.AccessLogConfig
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+}
+
+func NewAccessLog(conf config.AccessLogConfig) *AccessLog {
+	accessLog := &AccessLog{}
+	accessLog.Update(conf)
+	return accessLog
+}
+
+// Update apply conf to the requests started after.
+func (a *AccessLog) Update(conf config.AccessLogConfig) {
+	settings := &accessLogSettings{
+		conf:          conf,
+		redactHeaders: make(map[string]bool, len(conf.RedactHeaders)),
+		redactFields:  make(map[string]bool, len(conf.RedactFields)),
+	}
+	for _, header := range conf.RedactHeaders {
+		settings.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range conf.RedactFields {
+		settings.redactFields[strings.ToLower(field)] = true
+	}
+	a.settings.Store(settings)
+}
+
+func (a *AccessLog) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		settings := a.settings.Load()
+		conf := settings.conf
+
+		correlationID := c.GetHeader(logger.CorrelationID)
+		if !validCorrelationID(correlationID) {
+			correlationID = newCorrelationID()
+		}
+		c.Header(logger.CorrelationID, correlationID)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), logger.CorrelationID, correlationID))
+
+		var body []byte
+		if conf.LogBody {
+			body = peekBody(c.Request, conf.MaxBodySize)
+		}
+
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		slow := conf.SlowThreshold > 0 && latency >= conf.SlowThreshold
+		if status < http.StatusBadRequest && !slow && !sampled(conf.SuccessSampleRate) {
+			return
+		}
+
+		fields := log.Fields{
+			"type":          "access",
+			"method":        c.Request.Method,
+			"route":         metricsRoute(c),
+			"path":          c.Request.URL.Path,
+			"status":        status,
+			"latency":       latency.String(),
+			"latencyMs":     float64(latency.Microseconds()) / 1000,
+			"bytes":         c.Writer.Size(),
+			"clientIp":      c.ClientIP(),
+			"correlationId": correlationID,
+		}
+		//the tracing middleware, after this one, put the span in the request context
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			fields["traceId"] = spanContext.TraceID().String()
+		}
+		if user := requestUser(c); user != "" {
+			fields["user"] = user
+		}
+		if conf.LogHeaders {
+			fields["headers"] = redactHeaderValues(c.Request.Header, settings.redactHeaders)
+		}
+		if body != nil {
+			if redacted, ok := redactBody(body, settings.redactFields); ok {
+				fields["body"] = redacted
+			}
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.String()
+		}
+
+		entry := log.WithFields(fields)
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request failed")
+		case status >= http.StatusBadRequest:
+			entry.Warn("request rejected")
+		case slow:
+			entry.Warn("slow request")
+		default:
+			entry.Info("request served")
+		}
+	}
+}
+
+// sampled return true for a ratio rate of the calls.
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(sampleResolution))
+	if err != nil {
+		return true
+	}
+	return n.Int64() < int64(rate*sampleResolution)
+}
+
+// validCorrelationID return true when id can be logged and sent back as is.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestUser return the user set by an authentication middleware, or the user of the basic auth.
+func requestUser(c *gin.Context) string {
+	if user := c.GetString(UserContextKey); user != "" {
+		return user
+	}
+	user, _, _ := c.Request.BasicAuth()
+	return user
+}
+
+func redactHeaderValues(header http.Header, redact map[string]bool) map[string]string {
+	values := make(map[string]string, len(header))
+	for name, value := range header {
+		if redact[http.CanonicalHeaderKey(name)] {
+			values[name] = redactedValue
+			continue
+		}
+		values[name] = strings.Join(value, ", ")
+	}
+	return values
+}
+
+// peekBody read the body of a json request up to maxSize and put it back for the handlers,
+// it return nil for the other requests and the larger bodies, which are not logged.
+func peekBody(r *http.Request, maxSize int64) []byte {
+	if r.Body == nil || maxSize <= 0 || !strings.HasPrefix(r.Header.Get("Content-Type"), gin.MIMEJSON) {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+	if err != nil || int64(len(body)) > maxSize {
+		return nil
+	}
+	return body
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// redactBody replace the fields of redact in the json body, at any depth. A body which is not
+// valid json is not logged, it can't be redacted.
+func redactBody(body []byte, redact map[string]bool) (interface{}, bool) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, false
+	}
+	return redactValue(value, redact), true
+}
+
+func redactValue(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redact[strings.ToLower(key)] {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactValue(field, redact)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, redact)
+		}
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/httplib"
+	"go-gin-gorm-example/infrastructure/idempotency"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyFormat      = "idempotency:%s:%s:%s"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyKeyTTL  = 24 * time.Hour
+	defaultInFlightKeyTTL     = time.Minute
+	idempotencyRecordCapacity = 1024
+	// maxIdempotencyBodySize bound the body buffered for the fingerprint
+	maxIdempotencyBodySize = 1 << 20
+)
+
+// IdempotencyMiddleware make POST requests carrying an Idempotency-Key header safe to retry.
+// The first execution stores its response, a retry with the same key and body
+// replays it, the same key with a different body is rejected with 409,
+// and a retry while the first execution is still running gets 425. A body over 1MB is rejected with 413.
+// The key of a request still executed is kept for inFlightTTL, the stored response for ttl.
+func IdempotencyMiddleware(store idempotency.Store, ttl, inFlightTTL time.Duration) gin.HandlerFunc {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+	if inFlightTTL <= 0 {
+		inFlightTTL = defaultInFlightKeyTTL
+	}
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || idempotencyKey == "" {
+			c.Next()
+			return
+		}
+
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			httplib.SetErrorResponse(c, http.StatusBadRequest, "idempotency key is too long")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotencyBodySize+1))
+		if err != nil {
+			httplib.SetErrorResponse(c, http.StatusBadRequest, "failed to read body request")
+			c.Abort()
+			return
+		}
+		if len(body) > maxIdempotencyBodySize {
+			httplib.SetErrorResponse(c, http.StatusRequestEntityTooLarge, "body request is too large for an idempotency key")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+		storeKey := fmt.Sprintf(idempotencyKeyFormat, c.Request.Method, c.FullPath(), idempotencyKey)
+
+		existing, reserved, err := store.Reserve(c.Request.Context(), storeKey, fingerprint, inFlightTTL)
+		if err != nil {
+			log.Errorf("failed reserve idempotency key %s: %v", idempotencyKey, err)
+			httplib.SetErrorResponse(c, http.StatusInternalServerError, "oops, something went wrong!")
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			switch {
+			case existing.Fingerprint != "" && existing.Fingerprint != fingerprint:
+				httplib.SetErrorResponse(c, http.StatusConflict, "idempotency key is already used with a different request")
+			case !existing.Completed:
+				httplib.SetErrorResponse(c, http.StatusTooEarly, "request with the same idempotency key is still in progress")
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		writer := &bodyCaptureWriter{
+			ResponseWriter: c.Writer,
+			body:           bytes.NewBuffer(make([]byte, 0, idempotencyRecordCapacity)),
+		}
+		c.Writer = writer
+
+		//the key is completed or released even when the client went away
+		storeCtx := context.WithoutCancel(c.Request.Context())
+		completed := false
+		defer func() {
+			// on panic or server error the key is released, so the client can retry
+			if !completed {
+				if errRelease := store.Release(storeCtx, storeKey); errRelease != nil {
+					log.Errorf("failed release idempotency key %s: %v", idempotencyKey, errRelease)
+				}
+			}
+		}()
+
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+		errComplete := store.Complete(storeCtx, storeKey, idempotency.Record{
+			Fingerprint: fingerprint,
+			StatusCode:  writer.Status(),
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}, ttl)
+		if errComplete != nil {
+			log.Errorf("failed store idempotency response of key %s: %v", idempotencyKey, errComplete)
+			return
+		}
+		completed = true
+	}
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// bodyCaptureWriter keep a copy of the response body written by the handler.
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
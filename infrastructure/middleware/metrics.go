@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute is the route label of the requests matching no route, so unknown paths don't make new series.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware count the requests and observe their latency by route template and status.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := metricsRoute(c)
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsRoute(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return unmatchedRoute
+}
@@ -5,6 +5,7 @@ import (
 
 	"go-gin-gorm-example/infrastructure/httplib"
 	"go-gin-gorm-example/infrastructure/limiter"
+	"go-gin-gorm-example/infrastructure/metrics"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +16,7 @@ func RateLimiterMiddleware(rateLimiter *limiter.RateLimiter) gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		metrics.RateLimiterRejected.WithLabelValues(metricsRoute(c)).Inc()
 		httplib.SetErrorResponse(c, http.StatusTooManyRequests, "rate limit exceeded")
 		c.Abort()
 	}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ReadPrimaryUntilHeader carry the end of the read-your-writes window in unix milliseconds,
+	// a client without cookies send back the value it received.
+	ReadPrimaryUntilHeader = "X-Read-Primary-Until"
+	readPrimaryUntilCookie = "read_primary_until"
+
+	defaultReadYourWritesWindow = 5 * time.Second
+)
+
+// ReadYourWritesMiddleware send the reads of a client to the primary for window after its last successful write,
+// so it doesn't read a replica which didn't replay the write yet. The end of the window is given
+// back in a cookie and a header, so it follows the client whichever instance serves the next request,
+// an end sent further than window is cut to window.
+func ReadYourWritesMiddleware(window time.Duration) gin.HandlerFunc {
+	if window <= 0 {
+		window = defaultReadYourWritesWindow
+	}
+	return func(c *gin.Context) {
+		now := time.Now()
+		sticky := false
+		var writer *stickyWriter
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			sticky = now.Before(readPrimaryUntil(c, now.Add(window)))
+		default:
+			//the window is given back only once the write succeeded, before the response is written
+			writer = &stickyWriter{ResponseWriter: c.Writer, onHeader: func(w gin.ResponseWriter) {
+				until := time.Now().Add(window)
+				value := strconv.FormatInt(until.UnixMilli(), 10)
+				http.SetCookie(w, &http.Cookie{
+					Name:     readPrimaryUntilCookie,
+					Value:    value,
+					Path:     "/",
+					Expires:  until,
+					MaxAge:   int((window + time.Second - 1) / time.Second),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				w.Header().Set(ReadPrimaryUntilHeader, value)
+			}}
+			c.Writer = writer
+			sticky = true
+		}
+
+		if sticky {
+			c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+
+		//a response without body is written by gin after the middlewares
+		if writer != nil {
+			writer.beforeHeader()
+		}
+	}
+}
+
+// readPrimaryUntil return the end of the read-your-writes window sent by the client, zero without one,
+// a value after limit is cut to limit so a client can't pin its reads to the primary.
+func readPrimaryUntil(c *gin.Context, limit time.Time) time.Time {
+	value := c.GetHeader(ReadPrimaryUntilHeader)
+	if value == "" {
+		cookie, err := c.Request.Cookie(readPrimaryUntilCookie)
+		if err != nil {
+			return time.Time{}
+		}
+		value = cookie.Value
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	until := time.UnixMilli(millis)
+	if until.After(limit) {
+		return limit
+	}
+	return until
+}
+
+// stickyWriter call onHeader before the headers of a response under 400 are written.
+type stickyWriter struct {
+	gin.ResponseWriter
+	onHeader func(w gin.ResponseWriter)
+	done     bool
+}
+
+func (w *stickyWriter) beforeHeader() {
+	if w.done || w.Written() {
+		return
+	}
+	w.done = true
+	if w.Status() < http.StatusBadRequest {
+		w.onHeader(w.ResponseWriter)
+	}
+}
+
+func (w *stickyWriter) WriteHeaderNow() {
+	w.beforeHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *stickyWriter) Write(b []byte) (int, error) {
+	w.beforeHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *stickyWriter) WriteString(s string) (int, error) {
+	w.beforeHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *stickyWriter) Flush() {
+	w.beforeHeader()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/breaker"
+
+	"github.com/go-redis/redis"
+)
+
+// BreakerClient is a LibInterface calling redis through a circuit breaker, the cache is bypassed
+// while the breaker is open: every call return breaker.ErrOpen right away.
+type BreakerClient struct {
+	remote  LibInterface
+	breaker *breaker.Breaker
+}
+
+func NewBreakerClient(remote LibInterface, b *breaker.Breaker) *BreakerClient {
+	return &BreakerClient{
+		remote:  remote,
+		breaker: b,
+	}
+}
+
+// IsFailure return true when err is a failure of redis, a key already taken or missing is not,
+// nor a call cancelled by the client going away.
+func IsFailure(err error) bool {
+	return !errors.Is(err, ErrMultipleKeyInCache) && !errors.Is(err, redis.Nil) && !errors.Is(err, context.Canceled)
+}
+
+// canceled wrap context.Canceled in err when ctx was cancelled by the client, redis report it
+// like a connection error which would count as a failure.
+func canceled(ctx context.Context, err error) error {
+	if err != nil && !errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", context.Canceled, err)
+	}
+	return err
+}
+
+func (c *BreakerClient) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	return c.breaker.Execute(func() error {
+		return canceled(ctx, c.remote.SetIdempotencyKey(ctx, key, value, ttl))
+	})
+}
+
+func (c *BreakerClient) DeleteKey(ctx context.Context, key string) (err error) {
+	return c.breaker.Execute(func() error {
+		return canceled(ctx, c.remote.DeleteKey(ctx, key))
+	})
+}
+
+func (c *BreakerClient) Get(ctx context.Context, key string) (value string, err error) {
+	err = c.breaker.Execute(func() error {
+		value, err = c.remote.Get(ctx, key)
+		return canceled(ctx, err)
+	})
+	return value, err
+}
+
+func (c *BreakerClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	return c.breaker.Execute(func() error {
+		return canceled(ctx, c.remote.Set(ctx, key, value, ttl))
+	})
+}
+
+func (c *BreakerClient) DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error) {
+	err = c.breaker.Execute(func() error {
+		deleted, err = c.remote.DeleteByPattern(ctx, pattern)
+		return canceled(ctx, err)
+	})
+	return deleted, err
+}
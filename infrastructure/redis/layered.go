@@ -0,0 +1,329 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLocalCacheMaxEntries   = 1000
+	defaultLocalCacheTTL          = 10 * time.Second
+	defaultInvalidationChannel    = "cache:invalidation"
+	invalidationMessageSeparator  = "|"
+	invalidationSubscriberBacklog = 100
+	globCharacters                = "*?["
+)
+
+// LayeredClient is a LibInterface combining a small in-process LRU (L1)
+// with redis (L2). Every write or delete done through this client is published
+// on the invalidation channel, so the other replicas evict their L1 entry as well.
+type LayeredClient struct {
+	remote      LibInterface
+	redisClient *redis.Client
+	local       *localCache
+	prefixes    atomic.Pointer[[]config.LocalCachePrefixConfig]
+	channel     string
+	instanceID  string
+	pubSub      *redis.PubSub
+}
+
+// NewLayeredClient wrap the remote redis library with an in-process cache,
+// and start listening the invalidation channel.
+func NewLayeredClient(redisClient *redis.Client, remote LibInterface, conf config.LocalCacheConfig) *LayeredClient {
+	maxEntries := conf.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultLocalCacheMaxEntries
+	}
+
+	channel := conf.InvalidationChannel
+	if channel == "" {
+		channel = defaultInvalidationChannel
+	}
+
+	layered := &LayeredClient{
+		remote:      remote,
+		redisClient: redisClient,
+		local:       newLocalCache(maxEntries),
+		channel:     channel,
+		instanceID:  newInstanceID(),
+	}
+	layered.UpdatePrefixes(conf.Prefixes)
+	layered.subscribe()
+
+	return layered
+}
+
+func (l *LayeredClient) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	return l.remote.SetIdempotencyKey(ctx, key, value, ttl)
+}
+
+func (l *LayeredClient) DeleteKey(ctx context.Context, key string) (err error) {
+	err = l.remote.DeleteKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	l.local.remove(key)
+	l.publishInvalidation(key)
+	return nil
+}
+
+func (l *LayeredClient) Get(ctx context.Context, key string) (value string, err error) {
+	ttl, cached := l.localTTL(key)
+	if !cached {
+		return l.remote.Get(ctx, key)
+	}
+
+	if value, ok := l.local.get(key); ok {
+		return value, nil
+	}
+
+	//an invalidation received during the fetch mark it stale, so the value read before it is not cached
+	fetch := l.local.startFetch(key)
+	value, err = l.remote.Get(ctx, key)
+	if err != nil {
+		l.local.endFetch(key, fetch, "", ttl)
+		return "", err
+	}
+	l.local.endFetch(key, fetch, value, ttl)
+	return value, nil
+}
+
+func (l *LayeredClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	err = l.remote.Set(ctx, key, value, ttl)
+	if err != nil {
+		return err
+	}
+
+	// drop the local copy instead of storing the new value, the next Get
+	// read it back from redis in the same representation as the other replicas.
+	l.local.remove(key)
+	l.publishInvalidation(key)
+	return nil
+}
+
+func (l *LayeredClient) DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error) {
+	deleted, err = l.remote.DeleteByPattern(ctx, pattern)
+	if err != nil {
+		return deleted, err
+	}
+	l.local.removeMatching(pattern)
+	l.publish(pattern)
+	return deleted, nil
+}
+
+// Close stop listening the invalidation channel.
+func (l *LayeredClient) Close() error {
+	if l.pubSub == nil {
+		return nil
+	}
+	return l.pubSub.Close()
+}
+
+// UpdatePrefixes change the keys kept in the local cache and their ttl, the entries already
+// cached keep the ttl they were set with.
+func (l *LayeredClient) UpdatePrefixes(prefixes []config.LocalCachePrefixConfig) {
+	// longest prefix first, so the most specific rule wins
+	sorted := make([]config.LocalCachePrefixConfig, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	l.prefixes.Store(&sorted)
+}
+
+// localTTL return the local ttl of the key and whether the key is eligible for the local cache.
+func (l *LayeredClient) localTTL(key string) (time.Duration, bool) {
+	for _, prefix := range *l.prefixes.Load() {
+		if strings.HasPrefix(key, prefix.Prefix) {
+			if prefix.TTL <= 0 {
+				return defaultLocalCacheTTL, true
+			}
+			return prefix.TTL, true
+		}
+	}
+	return 0, false
+}
+
+func (l *LayeredClient) publishInvalidation(key string) {
+	if _, cached := l.localTTL(key); !cached {
+		return
+	}
+	l.publish(key)
+}
+
+// publish send the key or the glob pattern to evict to the other replicas.
+func (l *LayeredClient) publish(key string) {
+	message := l.instanceID + invalidationMessageSeparator + key
+	if err := l.redisClient.Publish(l.channel, message).Err(); err != nil {
+		log.Errorf("failed publish cache invalidation of key %s: %v", key, err)
+	}
+}
+
+func (l *LayeredClient) subscribe() {
+	l.pubSub = l.redisClient.Subscribe(l.channel)
+	messages := l.pubSub.ChannelSize(invalidationSubscriberBacklog)
+	go func() {
+		for message := range messages {
+			instanceID, key, found := strings.Cut(message.Payload, invalidationMessageSeparator)
+			if !found || instanceID == l.instanceID {
+				continue
+			}
+			if strings.ContainsAny(key, globCharacters) {
+				l.local.removeMatching(key)
+				continue
+			}
+			l.local.remove(key)
+		}
+	}()
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format(time.RFC3339Nano)
+	}
+	return hex.EncodeToString(b)
+}
+
+// localCache is a size bounded LRU cache with a ttl per entry.
+type localCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	// fetches is the keys read from redis to be cached, removed once cached
+	fetches map[string]*localFetch
+}
+
+// localFetch is the reads in flight of a key, stale once the key is invalidated during them.
+type localFetch struct {
+	readers int
+	stale   bool
+}
+
+type localEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func newLocalCache(maxEntries int) *localCache {
+	return &localCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		fetches:    make(map[string]*localFetch),
+	}
+}
+
+func (c *localCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*localEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(element)
+		return "", false
+	}
+	c.ll.MoveToFront(element)
+	return entry.value, true
+}
+
+// startFetch register a read of key from redis, ended by endFetch.
+func (c *localCache) startFetch(key string) *localFetch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fetch, ok := c.fetches[key]
+	if !ok {
+		fetch = &localFetch{}
+		c.fetches[key] = fetch
+	}
+	fetch.readers++
+	return fetch
+}
+
+// endFetch cache the value read by fetch, unless it is empty or key was invalidated during the read.
+func (c *localCache) endFetch(key string, fetch *localFetch, value string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fetch.readers--
+	if fetch.readers == 0 {
+		delete(c.fetches, key)
+	}
+	if fetch.stale || value == "" {
+		return
+	}
+	c.setLocked(key, value, ttl)
+}
+
+// setLocked store value for ttl, the caller hold the lock.
+func (c *localCache) setLocked(key, value string, ttl time.Duration) {
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*localEntry)
+		entry.value = value
+		entry.expiresAt = time.Now().Add(ttl)
+		c.ll.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&localEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+	})
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *localCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+	if fetch, ok := c.fetches[key]; ok {
+		fetch.stale = true
+	}
+}
+
+func (c *localCache) removeMatching(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.items {
+		if matched, _ := path.Match(pattern, key); matched {
+			c.removeElement(element)
+		}
+	}
+	for key, fetch := range c.fetches {
+		if matched, _ := path.Match(pattern, key); matched {
+			fetch.stale = true
+		}
+	}
+}
+
+func (c *localCache) removeElement(element *list.Element) {
+	c.ll.Remove(element)
+	delete(c.items, element.Value.(*localEntry).key)
+}
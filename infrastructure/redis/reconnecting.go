@@ -0,0 +1,203 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/retry"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultHealthCheckInterval = 5 * time.Second
+
+// ErrRedisUnavailable is returned without calling redis while it is reconnecting.
+var ErrRedisUnavailable = errors.New("redis is unavailable, reconnecting")
+
+// ReconnectingClient is a LibInterface failing fast while redis is down instead of waiting
+// for the dial timeout on every call. Redis is pinged every health check interval, and a
+// connection error on a command mark it down right away, it is then pinged with the backoff
+// until it answer again.
+type ReconnectingClient struct {
+	remote      LibInterface
+	redisClient *redis.Client
+	state       *retry.State
+	backoff     retry.Backoff
+	interval    time.Duration
+
+	reconnecting atomic.Bool
+	stop         chan struct{}
+}
+
+// Connect create the redis library of conf, the first ping is retried with the backoff of conf.Startup.Retry.
+// In degraded mode a redis still down after the retries is returned not ready and reconnect in the background.
+func Connect(ctx context.Context, conf *config.Config, degraded bool) (*redis.Client, *ReconnectingClient, error) {
+	redisClient, err := NewRedisClient(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backoff := retry.NewBackoff(conf.Startup.Retry)
+	err = retry.Do(ctx, backoff, "connect to redis", func(ctx context.Context) error {
+		return redisClient.Ping().Err()
+	})
+	if err != nil && !degraded {
+		_ = redisClient.Close()
+		return nil, nil, err
+	}
+
+	remote := newLib(redisClient)
+	if conf.Tracing.EnableTracing {
+		remote = NewTracingClient(remote)
+	}
+	lib := NewReconnectingClient(redisClient, remote, retry.NewState("redis", err == nil), backoff, conf.Redis.HealthCheckInterval)
+	if err != nil {
+		log.Printf("redis is not reachable, starting in degraded mode: %v", err)
+		lib.markDown(err)
+	} else {
+		log.Printf("Connected to redis on %s (DB: %d)", conf.Redis.Host, conf.Redis.DB)
+	}
+	return redisClient, lib, nil
+}
+
+// NewReconnectingClient wrap remote and start the health check of redisClient.
+func NewReconnectingClient(redisClient *redis.Client, remote LibInterface, state *retry.State, backoff retry.Backoff, interval time.Duration) *ReconnectingClient {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	c := &ReconnectingClient{
+		remote:      remote,
+		redisClient: redisClient,
+		state:       state,
+		backoff:     backoff.Forever(),
+		interval:    interval,
+		stop:        make(chan struct{}),
+	}
+	go c.healthCheck()
+	return c
+}
+
+// State return the availability of redis.
+func (c *ReconnectingClient) State() *retry.State {
+	return c.state
+}
+
+// Close stop the health check and the reconnection.
+func (c *ReconnectingClient) Close() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+}
+
+func (c *ReconnectingClient) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	if !c.state.Ready() {
+		return ErrRedisUnavailable
+	}
+	return c.observe(c.remote.SetIdempotencyKey(ctx, key, value, ttl))
+}
+
+func (c *ReconnectingClient) DeleteKey(ctx context.Context, key string) (err error) {
+	if !c.state.Ready() {
+		return ErrRedisUnavailable
+	}
+	return c.observe(c.remote.DeleteKey(ctx, key))
+}
+
+func (c *ReconnectingClient) Get(ctx context.Context, key string) (value string, err error) {
+	if !c.state.Ready() {
+		return "", ErrRedisUnavailable
+	}
+	value, err = c.remote.Get(ctx, key)
+	return value, c.observe(err)
+}
+
+func (c *ReconnectingClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	if !c.state.Ready() {
+		return ErrRedisUnavailable
+	}
+	return c.observe(c.remote.Set(ctx, key, value, ttl))
+}
+
+func (c *ReconnectingClient) DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error) {
+	if !c.state.Ready() {
+		return 0, ErrRedisUnavailable
+	}
+	deleted, err = c.remote.DeleteByPattern(ctx, pattern)
+	return deleted, c.observe(err)
+}
+
+// observe mark redis down when err is a connection error.
+func (c *ReconnectingClient) observe(err error) error {
+	if isConnectionError(err) {
+		c.markDown(err)
+	}
+	return err
+}
+
+func (c *ReconnectingClient) markDown(err error) {
+	c.state.MarkDown(err)
+	if c.reconnecting.CompareAndSwap(false, true) {
+		go c.reconnect()
+	}
+}
+
+func (c *ReconnectingClient) reconnect() {
+	defer c.reconnecting.Store(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := retry.Do(ctx, c.backoff, "reconnect to redis", func(ctx context.Context) error {
+		err := c.redisClient.Ping().Err()
+		if err != nil {
+			c.state.MarkDown(err)
+		}
+		return err
+	})
+	if err == nil {
+		c.state.MarkReady()
+	}
+}
+
+func (c *ReconnectingClient) healthCheck() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if !c.state.Ready() {
+				continue
+			}
+			if err := c.redisClient.Ping().Err(); err != nil {
+				c.markDown(fmt.Errorf("health check: %w", err))
+			}
+		}
+	}
+}
+
+// isConnectionError return true when err mean redis is not reachable, not a failed command.
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
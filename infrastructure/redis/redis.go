@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -11,6 +12,8 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const scanBatchSize = 100
+
 var (
 	ErrMultipleKeyInCache = errors.New("error get multiple key in cache")
 )
@@ -19,7 +22,7 @@ var (
 func NewRedisLibInterface(redisClient *redis.Client) (redisLib LibInterface, err error) {
 	_, err = redisClient.Ping().Result()
 	if err != nil {
-		log.Fatalf("Open connection to redis, error: %v", err)
+		log.Printf("Open connection to redis, error: %v", err)
 		return nil, err
 	}
 	redisLib = newLib(redisClient)
@@ -43,10 +46,12 @@ type client struct {
 }
 
 type LibInterface interface {
-	SetIdempotencyKey(key string, value interface{}, ttl time.Duration) (err error)
-	DeleteKey(key string) (err error)
-	Get(key string) (value string)
-	Set(key string, value interface{}, ttl time.Duration) (err error)
+	SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error)
+	DeleteKey(ctx context.Context, key string) (err error)
+	// Get return an empty value and no error when key is missing
+	Get(ctx context.Context, key string) (value string, err error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error)
+	DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error)
 }
 
 func newLib(redisClient *redis.Client) LibInterface {
@@ -55,12 +60,13 @@ func newLib(redisClient *redis.Client) LibInterface {
 	}
 }
 
-func (r client) SetIdempotencyKey(key string, value interface{}, ttl time.Duration) (err error) {
-	valueInRedis := r.redisClient.Get(key).Val()
+func (r client) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	valueInRedis := r.redisClient.WithContext(ctx).Get(key).Val()
 	if len(valueInRedis) > 0 {
+		err = ErrMultipleKeyInCache
 		return
 	}
-	success, err := r.redisClient.SetNX(key, value, ttl).Result()
+	success, err := r.redisClient.WithContext(ctx).SetNX(key, value, ttl).Result()
 	if err != nil {
 		return
 	}
@@ -71,18 +77,45 @@ func (r client) SetIdempotencyKey(key string, value interface{}, ttl time.Durati
 	return
 }
 
-func (r client) DeleteKey(key string) (err error) {
-	val := r.redisClient.Get(key).Val()
+func (r client) DeleteKey(ctx context.Context, key string) (err error) {
+	val := r.redisClient.WithContext(ctx).Get(key).Val()
 	if len(val) > 0 {
-		return r.redisClient.Del(key).Err()
+		return r.redisClient.WithContext(ctx).Del(key).Err()
 	}
 	return
 }
 
-func (r client) Get(key string) string {
-	return r.redisClient.Get(key).Val()
+func (r client) Get(ctx context.Context, key string) (string, error) {
+	value, err := r.redisClient.WithContext(ctx).Get(key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r client) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return r.redisClient.WithContext(ctx).Set(key, value, ttl).Err()
 }
 
-func (r client) Set(key string, value interface{}, ttl time.Duration) error {
-	return r.redisClient.Set(key, value, ttl).Err()
+// DeleteByPattern delete every key matching the glob pattern, keys are iterated
+// with SCAN so redis is not blocked like with KEYS.
+func (r client) DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error) {
+	var cursor uint64
+	for {
+		var keys []string
+		keys, cursor, err = r.redisClient.WithContext(ctx).Scan(cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			count, err := r.redisClient.WithContext(ctx).Del(keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += count
+		}
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
 }
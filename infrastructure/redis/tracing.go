@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingClient is a LibInterface starting a client span, child of the span of ctx, around every call to redis.
+type TracingClient struct {
+	remote LibInterface
+}
+
+func NewTracingClient(remote LibInterface) *TracingClient {
+	return &TracingClient{
+		remote: remote,
+	}
+}
+
+func (c *TracingClient) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "redis."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(operation)),
+	)
+}
+
+func (c *TracingClient) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	ctx, span := c.start(ctx, "SetIdempotencyKey")
+	err = c.remote.SetIdempotencyKey(ctx, key, value, ttl)
+	if errors.Is(err, ErrMultipleKeyInCache) {
+		// the key is taken, redis answered
+		span.End()
+		return err
+	}
+	tracing.End(span, err)
+	return err
+}
+
+func (c *TracingClient) DeleteKey(ctx context.Context, key string) (err error) {
+	ctx, span := c.start(ctx, "DeleteKey")
+	err = c.remote.DeleteKey(ctx, key)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *TracingClient) Get(ctx context.Context, key string) (value string, err error) {
+	ctx, span := c.start(ctx, "Get")
+	value, err = c.remote.Get(ctx, key)
+	tracing.End(span, err)
+	return value, err
+}
+
+func (c *TracingClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	ctx, span := c.start(ctx, "Set")
+	err = c.remote.Set(ctx, key, value, ttl)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *TracingClient) DeleteByPattern(ctx context.Context, pattern string) (deleted int64, err error) {
+	ctx, span := c.start(ctx, "DeleteByPattern")
+	deleted, err = c.remote.DeleteByPattern(ctx, pattern)
+	tracing.End(span, err)
+	return deleted, err
+}
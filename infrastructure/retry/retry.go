@@ -0,0 +1,99 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 30 * time.Second
+	defaultMultiplier      = 2
+)
+
+// ErrAttemptsExhausted is wrapped in the error of Do when every attempt failed.
+var ErrAttemptsExhausted = errors.New("retry attempts exhausted")
+
+// Backoff is an exponential backoff with full jitter: the wait before the retry n is
+// a random duration between 0 and min(MaxInterval, InitialInterval * Multiplier^(n-1)),
+// so the instances started together don't all retry at the same time.
+type Backoff struct {
+	maxAttempts     int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	multiplier      float64
+}
+
+// NewBackoff build the backoff of conf, MaxAttempts 0 retry until the context is done.
+func NewBackoff(conf config.RetryConfig) Backoff {
+	backoff := Backoff{
+		maxAttempts:     conf.MaxAttempts,
+		initialInterval: conf.InitialInterval,
+		maxInterval:     conf.MaxInterval,
+		multiplier:      conf.Multiplier,
+	}
+	if backoff.initialInterval <= 0 {
+		backoff.initialInterval = defaultInitialInterval
+	}
+	if backoff.maxInterval <= 0 {
+		backoff.maxInterval = defaultMaxInterval
+	}
+	if backoff.maxInterval < backoff.initialInterval {
+		backoff.maxInterval = backoff.initialInterval
+	}
+	if backoff.multiplier < 1 {
+		backoff.multiplier = defaultMultiplier
+	}
+	return backoff
+}
+
+// Forever return a copy of b retrying until the context is done.
+func (b Backoff) Forever() Backoff {
+	b.maxAttempts = 0
+	return b
+}
+
+// Delay return the wait before the retry following the failed attempt, attempt start at 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	ceiling := float64(b.initialInterval) * math.Pow(b.multiplier, float64(attempt-1))
+	if ceiling > float64(b.maxInterval) || math.IsInf(ceiling, 0) || math.IsNaN(ceiling) {
+		ceiling = float64(b.maxInterval)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Do call fn until it succeed, the attempts are exhausted or ctx is done,
+// every failure is logged with name and the wait before the next attempt.
+func Do(ctx context.Context, backoff Backoff, name string, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				log.Infof("%s succeeded after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		if backoff.maxAttempts > 0 && attempt >= backoff.maxAttempts {
+			return fmt.Errorf("%w: %w", ErrAttemptsExhausted, err)
+		}
+
+		delay := backoff.Delay(attempt)
+		log.Warnf("%s failed (attempt %d), retrying in %s: %v", name, attempt, delay.Round(time.Millisecond), err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package retry
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State track whether a dependency reconnecting in the background is available,
+// a nil State is always ready.
+type State struct {
+	name string
+
+	mu      sync.RWMutex
+	ready   bool
+	lastErr error
+}
+
+func NewState(name string, ready bool) *State {
+	return &State{
+		name:  name,
+		ready: ready,
+	}
+}
+
+// Ready return true when the dependency is connected.
+func (s *State) Ready() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ready
+}
+
+// Err return the error which made the dependency unavailable, nil when it is ready.
+func (s *State) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastErr
+}
+
+// MarkReady record the dependency is connected again.
+func (s *State) MarkReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ready {
+		log.Infof("%s is connected", s.name)
+	}
+	s.ready = true
+	s.lastErr = nil
+}
+
+// MarkDown record the dependency is unavailable because of err,
+// it return true when it was ready before.
+func (s *State) MarkDown(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wasReady := s.ready
+	if wasReady {
+		log.Warnf("%s is unavailable, reconnecting: %v", s.name, err)
+	}
+	s.ready = false
+	s.lastErr = err
+	return wasReady
+}
@@ -5,25 +5,85 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/cli"
 	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/lifecycle"
 	"go-gin-gorm-example/router"
-	"go-gin-gorm-example/utils"
 
-	"github.com/gookit/event"
+	//the modules registering themselves
+	_ "go-gin-gorm-example/module/admin"
+	_ "go-gin-gorm-example/module/article"
+	_ "go-gin-gorm-example/module/health"
 )
 
 func main() {
+	var migrateCommand string
+	var checkConfig bool
 	flag.StringVar(&config.Env, "env", "local", "A config name that used by server")
+	flag.StringVar(&migrateCommand, "migrate", "", "Run the database migrations and exit, one of up|down|status|to=N")
+	flag.BoolVar(&checkConfig, "check-config", false, "Validate the config, print it with the secrets masked and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n", os.Args[0])
+		flag.PrintDefaults()
+		cli.Usage(flag.CommandLine.Output())
+	}
 	flag.Parse()
 
+	if checkConfig {
+		if err := runCheckConfig(os.Stdout); err != nil {
+			log.Fatalf("check config: %v", err)
+		}
+		return
+	}
+
+	if migrateCommand != "" {
+		if err := boot.RunMigration(migrateCommand); err != nil {
+			log.Fatalf("failed migrate database: %v", err)
+		}
+		return
+	}
+
+	//without subcommand the binary serve the http api
+	if flag.NArg() == 0 || flag.Arg(0) == "serve" {
+		serve()
+		return
+	}
+
+	if err := cli.Run(flag.Args()); err != nil {
+		if errors.Is(err, cli.ErrUnknownCommand) {
+			cli.Usage(os.Stderr)
+		}
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+// runCheckConfig load and validate the config of the env, then print the effective config on w.
+func runCheckConfig(w io.Writer) error {
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	out, err := conf.MaskedYAML()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(out); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# config %s is valid\n", config.Env)
+	return err
+}
+
+func serve() {
 	setup := boot.MakeHandler()
 	handlerRouter := router.NewHandlerRouter(setup)
 	app := handlerRouter.RouterWithMiddleware()
@@ -33,39 +93,58 @@ func main() {
 		port = fmt.Sprintf(":%v", 1234)
 	}
 
-	log.Printf("Server running on port %s", port)
 	serve := &http.Server{
 		Addr:    port,
 		Handler: app,
 	}
 
-	// Start server
-	go func() {
-		if err := serve.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatal("shutting down the server")
-		}
-	}()
+	//the server stop first, the requests in flight are drained before the data is flushed
+	serveErr := make(chan error, 1)
+	setup.Lifecycle.Append(lifecycle.Hook{
+		Name:     "http server",
+		Priority: lifecycle.PriorityServer,
+		Timeout:  config.Conf.Shutdown.DrainTimeout,
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", serve.Addr)
+			if err != nil {
+				return err
+			}
+			log.Printf("Server running on port %s", port)
+			go func() {
+				if err := serve.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					serveErr <- err
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if err := serve.Shutdown(ctx); err != nil {
+				//the requests still in flight after the drain timeout are cut
+				_ = serve.Close()
+				return err
+			}
+			return nil
+		},
+	})
+	if err := setup.Lifecycle.Start(context.Background()); err != nil {
+		log.Fatalf("failed start server: %v", err)
+	}
 
-	// Wait for interrupt signal to gracefully shut down the server with
-	// a timeout of 1 second.
-	quit := make(chan os.Signal)
+	// Wait for interrupt signal to gracefully shut down the server
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default sends syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall. SIGKILL but can"t be caught, so don't need to add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case err := <-serveErr:
+		log.Printf("Server failed: %v", err)
+	}
 	log.Println("Shutdown Server ...")
 
-	event.MustFire(utils.ShutDownEvent, nil)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	if err := serve.Shutdown(ctx); err != nil {
-		log.Fatal("Server Shutdown:", err)
-	}
-	select {
-	case <-ctx.Done():
-		log.Println("timeout of 1 seconds.")
+	if err := setup.Lifecycle.Stop(context.Background()); err != nil {
+		log.Fatalf("Server Shutdown: %v", err)
 	}
 	log.Println("Server exiting")
 }
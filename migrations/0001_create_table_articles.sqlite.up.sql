@@ -0,0 +1,9 @@
+create table if not exists articles (
+      id integer primary key autoincrement,
+      author varchar(255) null,
+      title varchar(255) null,
+      body text null,
+      created_at timestamp default current_timestamp,
+      updated_at timestamp null,
+      deleted_at timestamp null
+);
@@ -0,0 +1 @@
+alter table articles drop constraint if exists articles_pkey;
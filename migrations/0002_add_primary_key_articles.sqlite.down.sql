@@ -0,0 +1,2 @@
+-- the primary key is part of the table on sqlite, it is dropped with it by 0001
+select 1;
@@ -0,0 +1,2 @@
+-- sqlite can't add a primary key to an existing table, it is declared in 0001
+select 1;
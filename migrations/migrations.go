@@ -0,0 +1,9 @@
+// Package migrations holds the versioned sql schema migrations embedded in the binary.
+// Every migration is a pair of files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// a file named <version>_<name>.<dialect>.up.sql (postgres or sqlite) replace the shared one on that dialect.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
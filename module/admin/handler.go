@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/httplib"
+	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/infrastructure/validator"
+	"go-gin-gorm-example/module/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Http struct {
+	maxDebugWindow time.Duration
+}
+
+// NewHttp return the admin endpoints, the debug windows are limited to maxDebugWindow.
+func NewHttp(maxDebugWindow time.Duration) InterfaceHttp {
+	return &Http{
+		maxDebugWindow: maxDebugWindow,
+	}
+}
+
+type InterfaceHttp interface {
+	GroupAdmin(group *gin.RouterGroup)
+}
+
+func (h *Http) GroupAdmin(g *gin.RouterGroup) {
+	g.GET("/log/levels", h.GetLogLevels)
+	g.PUT("/log/levels", h.SetLogLevels)
+	g.PUT("/log/levels/:context", h.SetLogLevel)
+	g.DELETE("/log/levels/:context", h.RemoveLogLevel)
+	g.POST("/log/debug", h.StartDebugWindow)
+	g.DELETE("/log/debug", h.EndDebugWindow)
+}
+
+func (h *Http) GetLogLevels(c *gin.Context) {
+	httplib.SetSuccessResponse(c, http.StatusOK, http.StatusText(http.StatusOK), logger.CurrentLevels())
+}
+
+// SetLogLevels replace the base level and every level by context.
+func (h *Http) SetLogLevels(c *gin.Context) {
+	var requestBody primitive.LogLevelsReq
+	if !bindRequest(c, &requestBody) {
+		return
+	}
+
+	if err := logger.SetLevels(requestBody.Level, requestBody.Overrides); err != nil {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	httplib.SetSuccessResponse(c, http.StatusOK, primitive.SuccessUpdateLogLevels, logger.CurrentLevels())
+}
+
+// SetLogLevel set the level of a context, like service.GetListArticle, and the contexts under it.
+func (h *Http) SetLogLevel(c *gin.Context) {
+	var requestBody primitive.LogLevelReq
+	if !bindRequest(c, &requestBody) {
+		return
+	}
+
+	if err := logger.SetOverride(c.Param("context"), requestBody.Level); err != nil {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	httplib.SetSuccessResponse(c, http.StatusOK, primitive.SuccessUpdateLogLevels, logger.CurrentLevels())
+}
+
+func (h *Http) RemoveLogLevel(c *gin.Context) {
+	logger.RemoveOverride(c.Param("context"))
+	httplib.SetSuccessResponse(c, http.StatusOK, primitive.SuccessUpdateLogLevels, logger.CurrentLevels())
+}
+
+// StartDebugWindow log every context at debug level for a while, the levels revert by themselves after.
+func (h *Http) StartDebugWindow(c *gin.Context) {
+	var requestBody primitive.DebugWindowReq
+	if !bindRequest(c, &requestBody) {
+		return
+	}
+
+	duration, err := time.ParseDuration(requestBody.Duration)
+	if err != nil || duration < 0 || (h.maxDebugWindow > 0 && duration > h.maxDebugWindow) {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.DebugWindowIsNotValid)
+		return
+	}
+
+	logger.DebugFor(duration)
+	httplib.SetSuccessResponse(c, http.StatusOK, primitive.SuccessUpdateLogLevels, logger.CurrentLevels())
+}
+
+func (h *Http) EndDebugWindow(c *gin.Context) {
+	logger.DebugFor(0)
+	httplib.SetSuccessResponse(c, http.StatusOK, primitive.SuccessUpdateLogLevels, logger.CurrentLevels())
+}
+
+func bindRequest(c *gin.Context, requestBody interface{}) bool {
+	if err := c.ShouldBindJSON(requestBody); err != nil {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.SomethingWrongWithTheBodyRequest)
+		return false
+	}
+	if errValidateStruct := validator.ValidateStructResponseSliceString(requestBody); errValidateStruct != nil {
+		httplib.SetCustomResponse(c, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil, errValidateStruct)
+		return false
+	}
+	return true
+}
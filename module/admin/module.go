@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/infrastructure/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the admin module is enabled with admin.enableAdmin, its endpoints are behind basic auth
+func init() {
+	boot.RegisterModule(boot.Module{
+		Name: "admin",
+		Enabled: func(conf config.Config) bool {
+			return conf.Admin.EnableAdmin
+		},
+		Routes: func(routes boot.Routes) {
+			prefixAdmin := routes.Root.Group("/admin", gin.BasicAuth(gin.Accounts{config.Conf.Admin.Username: config.Conf.Admin.Password}))
+			NewHttp(config.Conf.Admin.MaxDebugWindow).GroupAdmin(prefixAdmin)
+		},
+	})
+}
@@ -0,0 +1,659 @@
+// Package articletest is the contract every article.RepositoryInterface implementation must respect,
+// run it from a test of the implementation with RunRepositoryContract and RunTransactionContract.
+package articletest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/primitive"
+)
+
+// RepositoryFactory return an empty repository, it is called once per sub test
+// and should register its cleanup with t.Cleanup.
+type RepositoryFactory func(t *testing.T) article.RepositoryInterface
+
+// RunRepositoryContract run every case of the contract against the repositories of newRepository.
+func RunRepositoryContract(t *testing.T, newRepository RepositoryFactory) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, repository article.RepositoryInterface)
+	}{
+		{"CreateAndFind", testCreateAndFind},
+		{"IDAssignment", testIDAssignment},
+		{"Filter", testFilter},
+		{"Delete", testDelete},
+		{"Pagination", testPagination},
+		{"Sorting", testSorting},
+		{"Upsert", testUpsert},
+		{"UpsertDeleted", testUpsertDeleted},
+		{"Concurrency", testConcurrency},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newRepository(t))
+		})
+	}
+}
+
+// TransactionFactory return an empty repository and the transactor of its store.
+type TransactionFactory func(t *testing.T) (article.RepositoryInterface, database.Transactor)
+
+// RunTransactionContract check the repository calls join the unit of work of the transactor.
+func RunTransactionContract(t *testing.T, newRepository TransactionFactory) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor)
+	}{
+		{"Commit", testCommit},
+		{"Rollback", testRollback},
+		{"NestedRollback", testNestedRollback},
+		{"PanicRollback", testPanicRollback},
+		{"ImportKeepIDs", testImportKeepIDs},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			repository, transactor := newRepository(t)
+			c.run(t, repository, transactor)
+		})
+	}
+}
+
+func testCreateAndFind(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Second)
+	created := mustCreate(t, repository, primitive.Article{Author: "author", Title: "title", Body: "body"})
+	if created.ID <= 0 {
+		t.Fatalf("created article has id %d, want a positive id", created.ID)
+	}
+	if created.CreatedAt.Before(before) {
+		t.Errorf("created article has createdAt %v, want now", created.CreatedAt)
+	}
+
+	found, err := repository.FindArticleByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("FindArticleByID(%d): %v", created.ID, err)
+	}
+	assertSameArticle(t, found, created)
+
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("CountArticle = %d, want 1", count)
+	}
+
+	_, err = repository.FindArticleByID(ctx, created.ID+1000)
+	if !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of an unknown id returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+}
+
+func testIDAssignment(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	first := mustCreate(t, repository, primitive.Article{Author: "a", Title: "a", Body: "a"})
+	second := mustCreate(t, repository, primitive.Article{ID: first.ID, Author: "b", Title: "b", Body: "b"})
+	if second.ID <= first.ID {
+		t.Fatalf("second article has id %d, want greater than %d, the given id must be ignored", second.ID, first.ID)
+	}
+
+	batch, err := repository.CreateArticles(ctx, []primitive.Article{
+		{ID: first.ID, Author: "c", Title: "c", Body: "c"},
+		{Author: "d", Title: "d", Body: "d"},
+	})
+	if err != nil {
+		t.Fatalf("CreateArticles: %v", err)
+	}
+	if len(batch) != 2 || batch[0].ID <= second.ID || batch[1].ID <= batch[0].ID {
+		t.Fatalf("CreateArticles assigned %v, want increasing ids after %d", articleIDs(batch), second.ID)
+	}
+
+	// ids given to UpsertArticles are kept, the sequence continue after them once reset
+	if err = repository.UpsertArticles(ctx, []primitive.Article{{ID: 100, Author: "e", Title: "e", Body: "e"}}); err != nil {
+		t.Fatalf("UpsertArticles: %v", err)
+	}
+	if err = repository.ResetIDSequence(ctx); err != nil {
+		t.Fatalf("ResetIDSequence: %v", err)
+	}
+	next := mustCreate(t, repository, primitive.Article{Author: "f", Title: "f", Body: "f"})
+	if next.ID <= 100 {
+		t.Errorf("article created after ResetIDSequence has id %d, want greater than 100", next.ID)
+	}
+}
+
+func testFilter(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	mustCreate(t, repository, primitive.Article{Author: "alice", Title: "first post", Body: "hello world"})
+	mustCreate(t, repository, primitive.Article{Author: "ALICE cooper", Title: "second post", Body: "nothing"})
+	mustCreate(t, repository, primitive.Article{Author: "bob", Title: "100% done", Body: "Hello again"})
+	mustCreate(t, repository, primitive.Article{Author: "carol", Title: "snake_case", Body: "underscore"})
+
+	cases := []struct {
+		name  string
+		param primitive.ParameterFindArticle
+		want  int
+	}{
+		{"no filter", primitive.ParameterFindArticle{}, 4},
+		{"author is case-insensitive", primitive.ParameterFindArticle{Author: "Alice"}, 2},
+		{"author is a contains", primitive.ParameterFindArticle{Author: "coop"}, 1},
+		{"query match the title", primitive.ParameterFindArticle{Query: "POST"}, 2},
+		{"query match the body", primitive.ParameterFindArticle{Query: "hello"}, 2},
+		{"author and query are combined", primitive.ParameterFindArticle{Author: "alice", Query: "hello"}, 1},
+		{"percent is not a wildcard", primitive.ParameterFindArticle{Query: "%"}, 1},
+		{"underscore is not a wildcard", primitive.ParameterFindArticle{Query: "e_c"}, 1},
+		{"no match", primitive.ParameterFindArticle{Query: "missing"}, 0},
+	}
+	for _, c := range cases {
+		c.param.PageSize = 10
+		count, err := repository.CountArticle(ctx, c.param)
+		if err != nil {
+			t.Fatalf("%s: CountArticle: %v", c.name, err)
+		}
+		list, err := repository.FindListArticle(ctx, c.param)
+		if err != nil {
+			t.Fatalf("%s: FindListArticle: %v", c.name, err)
+		}
+		if count != int64(c.want) || len(list) != c.want {
+			t.Errorf("%s: CountArticle = %d and FindListArticle returned %d articles, want %d", c.name, count, len(list), c.want)
+		}
+	}
+}
+
+func testDelete(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	kept := mustCreate(t, repository, primitive.Article{Author: "kept", Title: "kept", Body: "kept"})
+	deleted := mustCreate(t, repository, primitive.Article{Author: "deleted", Title: "deleted", Body: "deleted"})
+
+	if err := repository.DeleteArticle(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteArticle(%d): %v", deleted.ID, err)
+	}
+	if err := repository.DeleteArticle(ctx, deleted.ID); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("second DeleteArticle returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+	if err := repository.DeleteArticle(ctx, deleted.ID+1000); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("DeleteArticle of an unknown id returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+
+	if _, err := repository.FindArticleByID(ctx, deleted.ID); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of a deleted article returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+	if _, err := repository.FindArticleByID(ctx, kept.ID); err != nil {
+		t.Errorf("FindArticleByID(%d): %v", kept.ID, err)
+	}
+
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	list, err := repository.FindListArticle(ctx, primitive.ParameterFindArticle{PageSize: 10})
+	if err != nil {
+		t.Fatalf("FindListArticle: %v", err)
+	}
+	if count != 1 || len(list) != 1 || list[0].ID != kept.ID {
+		t.Errorf("after delete CountArticle = %d and FindListArticle returned %v, want only %d", count, articleIDs(list), kept.ID)
+	}
+}
+
+func testPagination(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		created := mustCreate(t, repository, primitive.Article{Author: "author", Title: fmt.Sprintf("title %d", i), Body: "body"})
+		ids = append(ids, created.ID)
+	}
+
+	cases := []struct {
+		name     string
+		offset   int
+		pageSize int
+		want     []int64
+	}{
+		{"first page", 0, 2, ids[0:2]},
+		{"middle page", 2, 2, ids[2:4]},
+		{"last partial page", 4, 2, ids[4:5]},
+		{"page larger than the data", 0, 10, ids},
+		{"offset on the end", 5, 2, nil},
+		{"offset after the end", 50, 2, nil},
+		{"empty page size", 0, 0, nil},
+	}
+	for _, c := range cases {
+		list, err := repository.FindListArticle(ctx, primitive.ParameterFindArticle{
+			Offset:    c.offset,
+			PageSize:  c.pageSize,
+			SortBy:    repository.SetParamQueryToOrderByQuery("id"),
+			SortOrder: "asc",
+		})
+		if err != nil {
+			t.Fatalf("%s: FindListArticle: %v", c.name, err)
+		}
+		if got := articleIDs(list); !equalIDs(got, c.want) {
+			t.Errorf("%s: FindListArticle returned %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func testSorting(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	// every field has distinct lowercase values so the order doesn't depend on the collation
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := repository.UpsertArticles(ctx, []primitive.Article{
+		{ID: 1, Author: "carol", Title: "bravo", Body: "zulu", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: 2, Author: "alice", Title: "charlie", Body: "yankee", CreatedAt: base},
+		{ID: 3, Author: "bob", Title: "alpha", Body: "xray", CreatedAt: base.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("UpsertArticles: %v", err)
+	}
+
+	cases := []struct {
+		orderBy string
+		asc     []int64
+	}{
+		{"id", []int64{1, 2, 3}},
+		{"author", []int64{2, 3, 1}},
+		{"title", []int64{3, 1, 2}},
+		{"body", []int64{3, 2, 1}},
+		{"created", []int64{2, 3, 1}},
+		{"unknown", []int64{2, 3, 1}},
+	}
+	for _, c := range cases {
+		for _, sortOrder := range []string{"asc", "desc"} {
+			want := c.asc
+			if sortOrder == "desc" {
+				want = []int64{c.asc[2], c.asc[1], c.asc[0]}
+			}
+			list, err := repository.FindListArticle(ctx, primitive.ParameterFindArticle{
+				PageSize:  10,
+				SortBy:    repository.SetParamQueryToOrderByQuery(c.orderBy),
+				SortOrder: sortOrder,
+			})
+			if err != nil {
+				t.Fatalf("order by %s %s: FindListArticle: %v", c.orderBy, sortOrder, err)
+			}
+			if got := articleIDs(list); !equalIDs(got, want) {
+				t.Errorf("order by %s %s returned %v, want %v", c.orderBy, sortOrder, got, want)
+			}
+		}
+	}
+}
+
+func testUpsert(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	created := mustCreate(t, repository, primitive.Article{Author: "before", Title: "before", Body: "before"})
+	if err := repository.DeleteArticle(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteArticle(%d): %v", created.ID, err)
+	}
+
+	createdAt := time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	err := repository.UpsertArticles(ctx, []primitive.Article{
+		{ID: created.ID, Author: "after", Title: "after", Body: "after", CreatedAt: createdAt, UpdatedAt: createdAt},
+		{ID: created.ID + 10, Author: "new", Title: "new", Body: "new", CreatedAt: createdAt, UpdatedAt: createdAt},
+	})
+	if err != nil {
+		t.Fatalf("UpsertArticles: %v", err)
+	}
+
+	restored, err := repository.FindArticleByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("FindArticleByID of the restored article: %v", err)
+	}
+	assertSameArticle(t, restored, primitive.Article{ID: created.ID, Author: "after", Title: "after", Body: "after", CreatedAt: createdAt})
+
+	inserted, err := repository.FindArticleByID(ctx, created.ID+10)
+	if err != nil {
+		t.Fatalf("FindArticleByID of the inserted article: %v", err)
+	}
+	assertSameArticle(t, inserted, primitive.Article{ID: created.ID + 10, Author: "new", Title: "new", Body: "new", CreatedAt: createdAt})
+
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountArticle = %d, want 2", count)
+	}
+}
+
+// testUpsertDeleted upsert a soft deleted article, like the copy between backends, it stays deleted
+// and is only listed with WithDeleted.
+func testUpsertDeleted(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	createdAt := time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	deletedAt := createdAt.Add(time.Hour)
+	err := repository.UpsertArticles(ctx, []primitive.Article{
+		{ID: 1, Author: "kept", Title: "kept", Body: "kept", CreatedAt: createdAt, UpdatedAt: createdAt},
+		{ID: 2, Author: "deleted", Title: "deleted", Body: "deleted", CreatedAt: createdAt, UpdatedAt: createdAt, DeletedAt: deletedAt},
+	})
+	if err != nil {
+		t.Fatalf("UpsertArticles: %v", err)
+	}
+
+	if _, err = repository.FindArticleByID(ctx, 2); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of the deleted article = %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+	listData, err := repository.FindListArticle(ctx, primitive.ParameterFindArticle{PageSize: 10, SortBy: "id", SortOrder: "asc"})
+	if err != nil {
+		t.Fatalf("FindListArticle: %v", err)
+	}
+	if got := articleIDs(listData); len(got) != 1 || got[0] != 1 {
+		t.Errorf("FindListArticle = %v, want [1]", got)
+	}
+
+	listData, err = repository.FindListArticle(ctx, primitive.ParameterFindArticle{PageSize: 10, SortBy: "id", SortOrder: "asc", WithDeleted: true})
+	if err != nil {
+		t.Fatalf("FindListArticle with the deleted: %v", err)
+	}
+	if got := articleIDs(listData); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("FindListArticle with the deleted = %v, want [1 2]", got)
+	}
+	if !listData[0].DeletedAt.IsZero() {
+		t.Errorf("article 1 has DeletedAt %v, want zero", listData[0].DeletedAt)
+	}
+	if !listData[1].DeletedAt.Equal(deletedAt) {
+		t.Errorf("article 2 has DeletedAt %v, want %v", listData[1].DeletedAt, deletedAt)
+	}
+}
+
+func testConcurrency(t *testing.T, repository article.RepositoryInterface) {
+	ctx := context.Background()
+
+	const workers, perWorker = 8, 10
+	ids := make(chan int64, workers*perWorker)
+	errs := make(chan error, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				created, err := repository.CreateArticle(ctx, primitive.Article{
+					Author: fmt.Sprintf("worker %d", w),
+					Title:  fmt.Sprintf("title %d", i),
+					Body:   "body",
+				})
+				if err != nil {
+					errs <- err
+					continue
+				}
+				ids <- created.ID
+				// readers run while the other workers write
+				if _, err = repository.FindListArticle(ctx, primitive.ParameterFindArticle{PageSize: 5}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent call: %v", err)
+	}
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("id %d was assigned twice", id)
+		}
+		seen[id] = true
+	}
+
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	if count != workers*perWorker {
+		t.Errorf("CountArticle = %d, want %d", count, workers*perWorker)
+	}
+}
+
+var errAbort = errors.New("abort the unit of work")
+
+// testImportKeepIDs import articles with their ids in upsert mode, the articles created
+// after them, in the same import and later, get the next ids.
+func testImportKeepIDs(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor) {
+	ctx := context.Background()
+	service := article.NewService(repository, transactor, nil)
+
+	mustCreate(t, repository, primitive.Article{Author: "a", Title: "a", Body: "a"})
+	records := `{"id":100,"author":"b","title":"b","body":"b"}
+{"id":101,"author":"c","title":"c","body":"c"}
+{"author":"d","title":"d","body":"d"}
+`
+	resp, err := service.ImportArticle(ctx, strings.NewReader(records), primitive.ParameterImportArticle{
+		Format: article.FormatNDJSON,
+		Mode:   article.ImportModeUpsert,
+	})
+	if err != nil {
+		t.Fatalf("ImportArticle: %v", err)
+	}
+	if resp.Imported != 3 {
+		t.Fatalf("ImportArticle imported %d articles, want 3", resp.Imported)
+	}
+
+	created, err := service.RecordArticle(ctx, primitive.ArticleReq{Author: "e", Title: "e", Body: "e"})
+	if err != nil {
+		t.Fatalf("RecordArticle after the import: %v", err)
+	}
+	if created.ID <= 102 {
+		t.Errorf("article created after the import has id %d, want greater than 102", created.ID)
+	}
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("CountArticle = %d, want 5", count)
+	}
+}
+
+func testCommit(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor) {
+	ctx := context.Background()
+
+	var created primitive.Article
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if created, err = repository.CreateArticle(ctx, primitive.Article{Author: "a", Title: "a", Body: "a"}); err != nil {
+			return err
+		}
+		_, err = repository.FindArticleByID(ctx, created.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+	if _, err = repository.FindArticleByID(ctx, created.ID); err != nil {
+		t.Errorf("FindArticleByID of the committed article: %v", err)
+	}
+}
+
+func testRollback(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor) {
+	ctx := context.Background()
+
+	kept := mustCreate(t, repository, primitive.Article{Author: "kept", Title: "kept", Body: "kept"})
+	changed := mustCreate(t, repository, primitive.Article{Author: "before", Title: "before", Body: "before"})
+
+	var created primitive.Article
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = repository.CreateArticle(ctx, primitive.Article{Author: "new", Title: "new", Body: "new"})
+		if err != nil {
+			return err
+		}
+		// the unit of work read its own changes
+		if _, err = repository.FindArticleByID(ctx, created.ID); err != nil {
+			return err
+		}
+		if err = repository.DeleteArticle(ctx, kept.ID); err != nil {
+			return err
+		}
+		changedArticle := changed
+		changedArticle.Title = "after"
+		if err = repository.UpsertArticles(ctx, []primitive.Article{changedArticle}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithinTransaction returned %v, want %v", err, errAbort)
+	}
+
+	if _, err = repository.FindArticleByID(ctx, created.ID); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of the rolled back article returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+	if _, err = repository.FindArticleByID(ctx, kept.ID); err != nil {
+		t.Errorf("FindArticleByID of the article deleted then rolled back: %v", err)
+	}
+	found, err := repository.FindArticleByID(ctx, changed.ID)
+	if err != nil {
+		t.Fatalf("FindArticleByID(%d): %v", changed.ID, err)
+	}
+	if found.Title != "before" {
+		t.Errorf("rolled back article has title %q, want %q", found.Title, "before")
+	}
+	count, err := repository.CountArticle(ctx, primitive.ParameterFindArticle{})
+	if err != nil {
+		t.Fatalf("CountArticle: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountArticle = %d, want 2", count)
+	}
+	// the rolled back creation leave no row, even a soft deleted one
+	withDeleted, err := repository.FindListArticle(ctx, primitive.ParameterFindArticle{PageSize: -1, WithDeleted: true})
+	if err != nil {
+		t.Fatalf("FindListArticle with the deleted articles: %v", err)
+	}
+	for _, article := range withDeleted {
+		if article.ID == created.ID {
+			t.Errorf("rolled back article %d is still stored with DeletedAt %v", created.ID, article.DeletedAt)
+		}
+	}
+	count, err = repository.CountArticle(ctx, primitive.ParameterFindArticle{WithDeleted: true})
+	if err != nil {
+		t.Fatalf("CountArticle with the deleted articles: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountArticle with the deleted articles = %d, want 2", count)
+	}
+}
+
+func testNestedRollback(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor) {
+	ctx := context.Background()
+
+	var outer, inner primitive.Article
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if outer, err = repository.CreateArticle(ctx, primitive.Article{Author: "outer", Title: "outer", Body: "outer"}); err != nil {
+			return err
+		}
+		err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if inner, err = repository.CreateArticle(ctx, primitive.Article{Author: "inner", Title: "inner", Body: "inner"}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			return fmt.Errorf("nested WithinTransaction returned %v, want %v", err, errAbort)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+
+	if _, err = repository.FindArticleByID(ctx, outer.ID); err != nil {
+		t.Errorf("FindArticleByID of the outer article: %v", err)
+	}
+	if _, err = repository.FindArticleByID(ctx, inner.ID); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of the article of the rolled back savepoint returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+}
+
+func testPanicRollback(t *testing.T, repository article.RepositoryInterface, transactor database.Transactor) {
+	ctx := context.Background()
+
+	var created primitive.Article
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("WithinTransaction didn't propagate the panic")
+			}
+		}()
+		_ = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if created, err = repository.CreateArticle(ctx, primitive.Article{Author: "a", Title: "a", Body: "a"}); err != nil {
+				return err
+			}
+			panic(errAbort)
+		})
+	}()
+
+	if _, err := repository.FindArticleByID(ctx, created.ID); !errors.Is(err, primitive.ErrorArticleNotFound) {
+		t.Errorf("FindArticleByID of the article created before the panic returned %v, want %v", err, primitive.ErrorArticleNotFound)
+	}
+}
+
+func mustCreate(t *testing.T, repository article.RepositoryInterface, payload primitive.Article) primitive.Article {
+	t.Helper()
+	created, err := repository.CreateArticle(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("CreateArticle: %v", err)
+	}
+	return created
+}
+
+// assertSameArticle compare the stored fields, createdAt is compared on its wall clock
+// with the precision of a sql timestamp column.
+func assertSameArticle(t *testing.T, got, want primitive.Article) {
+	t.Helper()
+	if got.ID != want.ID || got.Author != want.Author || got.Title != want.Title || got.Body != want.Body {
+		t.Errorf("got article %d %q %q %q, want %d %q %q %q",
+			got.ID, got.Author, got.Title, got.Body, want.ID, want.Author, want.Title, want.Body)
+	}
+	if diff := wallClock(got.CreatedAt).Sub(wallClock(want.CreatedAt)); diff > time.Millisecond || diff < -time.Millisecond {
+		t.Errorf("got article createdAt %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+}
+
+func wallClock(value time.Time) time.Time {
+	return time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), value.Nanosecond(), time.UTC)
+}
+
+func articleIDs(articles []primitive.Article) []int64 {
+	ids := make([]int64, 0, len(articles))
+	for _, article := range articles {
+		ids = append(ids, article.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
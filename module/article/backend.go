@@ -0,0 +1,86 @@
+package article
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/migrations"
+)
+
+const (
+	BackendMemory   = config.DriverMemory
+	BackendPostgres = config.DriverPostgres
+	BackendSQLite   = config.DriverSQLite
+)
+
+// RepositoryBackend is an article repository opened regardless of database.driver,
+// used by the commands moving data between backends.
+type RepositoryBackend struct {
+	Repository RepositoryInterface
+	// Close release the backend, the in-memory backend write its snapshot file back when persist is true
+	Close func(persist bool) error
+}
+
+// MakeRepositoryBackend open the article repository of the given backend, memory read its data from snapshotFile.
+// The config must be initialized before.
+func MakeRepositoryBackend(backend string, snapshotFile string) (RepositoryBackend, error) {
+	switch backend {
+	case BackendMemory:
+		repository := NewInMemoryRepository()
+		if err := repository.LockSnapshot(snapshotFile); err != nil {
+			return RepositoryBackend{}, fmt.Errorf("lock in-memory snapshot, stop the process using it first: %w", err)
+		}
+		repository.SetSnapshotRetention(config.Conf.InMemory.SnapshotRetention)
+		if config.Conf.InMemory.WAL.EnableWAL {
+			if err := repository.OpenWAL(config.Conf.InMemory.WAL); err != nil {
+				_ = repository.Close()
+				return RepositoryBackend{}, err
+			}
+		}
+		err := repository.LoadFromFile(snapshotFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			_ = repository.Close()
+			return RepositoryBackend{}, err
+		}
+		return RepositoryBackend{
+			Repository: repository,
+			Close: func(persist bool) error {
+				if persist {
+					if err := repository.SaveToFile(snapshotFile); err != nil {
+						return err
+					}
+				}
+				return repository.Close()
+			},
+		}, nil
+	case BackendPostgres, BackendSQLite:
+		//the copy read and verify on the primary only
+		conf := config.Conf
+		conf.Database.Driver = backend
+		conf.Postgres.Replica.Hosts = nil
+		//the migrations of the articles are applied on connect, even with the article module disabled
+		db, err := database.NewClient(&conf, migrations.FS)
+		if err != nil {
+			return RepositoryBackend{}, err
+		}
+		var repository RepositoryInterface = NewRepository(db.DbConn)
+		if backend == BackendSQLite {
+			repository = NewSQLiteRepository(db.DbConn)
+		}
+		return RepositoryBackend{
+			Repository: repository,
+			Close: func(persist bool) error {
+				sqlDB, err := db.DbConn.DB()
+				if err != nil {
+					return err
+				}
+				return sqlDB.Close()
+			},
+		}, nil
+	default:
+		return RepositoryBackend{}, fmt.Errorf("unknown backend %q, use %s, %s or %s", backend, BackendMemory, BackendPostgres, BackendSQLite)
+	}
+}
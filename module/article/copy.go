@@ -0,0 +1,135 @@
+package article
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/module/primitive"
+)
+
+const (
+	defaultCopyBatchSize = 500
+	// checksumTimeLayout is the wall clock with the precision of a postgres timestamp column,
+	// the column has no time zone so only the wall clock survives the copy.
+	checksumTimeLayout = "2006-01-02T15:04:05.000000"
+)
+
+// CopyReport is the result of CopyArticles, the copy is verified when both
+// the counts and the checksums of the source and the destination are equal.
+// The soft deleted articles are copied, counted and checksummed like the others.
+type CopyReport struct {
+	Copied              int    `json:"copied"`
+	SourceCount         int64  `json:"sourceCount"`
+	DestinationCount    int64  `json:"destinationCount"`
+	SourceChecksum      string `json:"sourceChecksum"`
+	DestinationChecksum string `json:"destinationChecksum"`
+}
+
+func (r CopyReport) Verified() bool {
+	return r.SourceCount == r.DestinationCount && r.SourceChecksum == r.DestinationChecksum
+}
+
+// CopyArticles read every article of source, the deleted ones included, and write it to destination
+// keeping its id and timestamps, then reset the id sequence of destination and compute
+// the count and checksum on both sides.
+func CopyArticles(ctx context.Context, source, destination RepositoryInterface, batchSize int) (CopyReport, error) {
+	logCtx := fmt.Sprintf("article.CopyArticles")
+
+	if batchSize <= 0 {
+		batchSize = defaultCopyBatchSize
+	}
+
+	var report CopyReport
+	err := eachArticle(ctx, source, batchSize, func(batch []primitive.Article) error {
+		if err := destination.UpsertArticles(ctx, batch); err != nil {
+			return err
+		}
+		report.Copied += len(batch)
+		logger.Info(ctx, logCtx, "copied %d articles", report.Copied)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if err = destination.ResetIDSequence(ctx); err != nil {
+		return report, err
+	}
+
+	report.SourceCount, report.SourceChecksum, err = checksumArticles(ctx, source, batchSize)
+	if err != nil {
+		return report, err
+	}
+	report.DestinationCount, report.DestinationChecksum, err = checksumArticles(ctx, destination, batchSize)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// eachArticle iterate every article of the repository ordered by id, batch by batch, the soft deleted included.
+func eachArticle(ctx context.Context, repository RepositoryInterface, batchSize int, fn func(batch []primitive.Article) error) error {
+	param := primitive.ParameterFindArticle{
+		PageSize:    batchSize,
+		SortBy:      repository.SetParamQueryToOrderByQuery("id"),
+		SortOrder:   "asc",
+		WithDeleted: true,
+	}
+	for {
+		listData, err := repository.FindListArticle(ctx, param)
+		if err != nil {
+			return err
+		}
+		if len(listData) > 0 {
+			if err = fn(listData); err != nil {
+				return err
+			}
+		}
+		if len(listData) < param.PageSize {
+			return nil
+		}
+		param.Offset += param.PageSize
+	}
+}
+
+// checksumArticles count the articles and compute a checksum independent of their order,
+// the sha256 of every article is summed lane by lane so both sides can be read in any order.
+func checksumArticles(ctx context.Context, repository RepositoryInterface, batchSize int) (int64, string, error) {
+	var count int64
+	var lanes [4]uint64
+	err := eachArticle(ctx, repository, batchSize, func(batch []primitive.Article) error {
+		for _, article := range batch {
+			sum := sha256.Sum256([]byte(strconv.FormatInt(article.ID, 10) + "\x00" +
+				article.Author + "\x00" +
+				article.Title + "\x00" +
+				article.Body + "\x00" +
+				checksumTime(article.CreatedAt) + "\x00" +
+				checksumTime(article.UpdatedAt) + "\x00" +
+				checksumTime(article.DeletedAt)))
+			for i := range lanes {
+				lanes[i] += binary.BigEndian.Uint64(sum[i*8 : (i+1)*8])
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return count, fmt.Sprintf("%016x%016x%016x%016x", lanes[0], lanes[1], lanes[2], lanes[3]), nil
+}
+
+// checksumTime is the wall clock of t rounded to the microsecond, empty for a time not set
+// like the deleted_at of an article not deleted.
+func checksumTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Round(time.Microsecond).Format(checksumTimeLayout)
+}
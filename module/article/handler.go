@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"go-gin-gorm-example/infrastructure/breaker"
 	"go-gin-gorm-example/infrastructure/httplib"
 	logger "go-gin-gorm-example/infrastructure/log"
 	"go-gin-gorm-example/infrastructure/validator"
@@ -28,20 +29,37 @@ func NewHttp(serviceHealth InterfaceService) InterfaceHttp {
 }
 
 type InterfaceHttp interface {
-	GroupArticle(group *gin.RouterGroup)
-	SaveToFile()
-	LoadFromFile()
+	GroupArticle(group *gin.RouterGroup, createMiddlewares ...gin.HandlerFunc)
+	SaveToFile() error
+	LoadFromFile() error
 }
 
-func (h *Http) GroupArticle(g *gin.RouterGroup) {
+// setServiceErrorResponse answer 503 while the circuit breaker of the database is open, 500 otherwise.
+func setServiceErrorResponse(c *gin.Context, err error) {
+	status, message := serviceErrorStatus(err)
+	httplib.SetErrorResponse(c, status, message)
+}
+
+// serviceErrorStatus return the status and message of an error of the service.
+func serviceErrorStatus(err error) (int, string) {
+	if errors.Is(err, breaker.ErrOpen) {
+		return http.StatusServiceUnavailable, primitive.ServiceIsUnavailable
+	}
+	return http.StatusInternalServerError, primitive.SomethingWentWrong
+}
+
+// GroupArticle mount the article routes on g, createMiddlewares run on POST "" only, like the idempotency key.
+func (h *Http) GroupArticle(g *gin.RouterGroup, createMiddlewares ...gin.HandlerFunc) {
 	g.GET("", h.GetListArticle)
+	g.GET("/export", h.ExportArticle)
+	g.POST("/import", h.ImportArticle)
 	g.GET("/:id", h.DetailArticle)
-	g.POST("", h.CreateArticle)
+	g.POST("", append(createMiddlewares, h.CreateArticle)...)
 }
 
 func (h *Http) GetListArticle(c *gin.Context) {
 	logCtx := fmt.Sprintf("handler.GetListArticle")
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method GetListArticle is nil")
@@ -85,7 +103,7 @@ func (h *Http) GetListArticle(c *gin.Context) {
 	data, count, err := h.serviceArticle.GetListArticle(ctx, param, paginationQuery)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetListArticle")
-		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		setServiceErrorResponse(c, err)
 		return
 	}
 
@@ -100,7 +118,7 @@ func (h *Http) GetListArticle(c *gin.Context) {
 
 func (h *Http) CreateArticle(c *gin.Context) {
 	logCtx := fmt.Sprintf("handler.CreateArticle")
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method CreateArticle is nil")
@@ -126,7 +144,7 @@ func (h *Http) CreateArticle(c *gin.Context) {
 	data, err := h.serviceArticle.RecordArticle(ctx, requestBody)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetListArticle")
-		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		setServiceErrorResponse(c, err)
 		return
 	}
 
@@ -137,7 +155,7 @@ func (h *Http) CreateArticle(c *gin.Context) {
 
 func (h *Http) DetailArticle(c *gin.Context) {
 	logCtx := fmt.Sprintf("handler.DetailArticle")
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	if h.serviceArticle == nil {
 		err := errors.New("dependency service article to handler article on method DetailArticle is nil")
@@ -171,7 +189,7 @@ func (h *Http) DetailArticle(c *gin.Context) {
 			return
 		}
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.GetDetailArticle")
-		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		setServiceErrorResponse(c, err)
 		return
 	}
 
@@ -180,12 +198,106 @@ func (h *Http) DetailArticle(c *gin.Context) {
 
 }
 
-func (h *Http) SaveToFile() {
+func (h *Http) ExportArticle(c *gin.Context) {
+	logCtx := fmt.Sprintf("handler.ExportArticle")
+	ctx := c.Request.Context()
+
+	if h.serviceArticle == nil {
+		err := errors.New("dependency service article to handler article on method ExportArticle is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		return
+	}
+
+	format := c.DefaultQuery("format", FormatNDJSON)
+	if !utils.Contains([]string{FormatJSON, FormatNDJSON, FormatCSV}, format) {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.FormatIsNotSupported)
+		return
+	}
+
+	c.Header("Content-Type", ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="articles.%s"`, format))
+	c.Status(http.StatusOK)
+
+	//the response is streamed, an error after the first byte can only be logged
+	_, err := h.serviceArticle.ExportArticle(ctx, c.Writer, format)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.ExportArticle")
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			setServiceErrorResponse(c, err)
+		}
+		return
+	}
+}
+
+func (h *Http) ImportArticle(c *gin.Context) {
+	logCtx := fmt.Sprintf("handler.ImportArticle")
+	ctx := c.Request.Context()
+
+	if h.serviceArticle == nil {
+		err := errors.New("dependency service article to handler article on method ImportArticle is nil")
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		return
+	}
+
+	format := c.DefaultQuery("format", FormatNDJSON)
+	if !utils.Contains([]string{FormatJSON, FormatNDJSON, FormatCSV}, format) {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.FormatIsNotSupported)
+		return
+	}
+
+	mode := c.DefaultQuery("mode", ImportModeUpsert)
+	if !utils.Contains([]string{ImportModeUpsert, ImportModeAppend}, mode) {
+		httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.ImportModeIsNotValid)
+		return
+	}
+
+	batchSize := defaultImportBatchSize
+	if batchSizeQuery := c.Query("batchSize"); batchSizeQuery != "" {
+		n, err := strconv.Atoi(batchSizeQuery)
+		if err != nil || n <= 0 {
+			httplib.SetErrorResponse(c, http.StatusBadRequest, "batchSize must be a positive number")
+			return
+		}
+		batchSize = n
+	}
+
+	param := primitive.ParameterImportArticle{
+		Format:    format,
+		Mode:      mode,
+		DryRun:    c.Query("dryRun") == "true",
+		BatchSize: batchSize,
+	}
+
+	data, err := h.serviceArticle.ImportArticle(ctx, c.Request.Body, param)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceArticle.ImportArticle")
+		if data.Total == 0 && !errors.Is(err, breaker.ErrOpen) {
+			httplib.SetErrorResponse(c, http.StatusBadRequest, primitive.SomethingWrongWithTheBodyRequest)
+			return
+		}
+		status, message := serviceErrorStatus(err)
+		httplib.SetCustomResponse(c, status, message, data, nil)
+		return
+	}
+
+	message := primitive.SuccessImportArticle
+	if param.DryRun {
+		message = primitive.SuccessDryRunArticle
+	}
+	httplib.SetSuccessResponse(c, http.StatusOK, message, data)
+	return
+}
+
+func (h *Http) SaveToFile() error {
 	ctx := context.Background()
-	h.serviceArticle.RecordArticleToFile(ctx)
+	return h.serviceArticle.RecordArticleToFile(ctx)
 }
 
-func (h *Http) LoadFromFile() {
+func (h *Http) LoadFromFile() error {
 	ctx := context.Background()
-	h.serviceArticle.LoadArticleToFile(ctx)
+	return h.serviceArticle.LoadArticleToFile(ctx)
 }
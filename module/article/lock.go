@@ -0,0 +1,19 @@
+//go:build !windows
+
+package article
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile take an exclusive lock on file, held until the file is closed,
+// ErrFileLocked is returned when another process holds it.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrFileLocked
+	}
+	return err
+}
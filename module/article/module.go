@@ -0,0 +1,151 @@
+package article
+
+import (
+	"context"
+	"fmt"
+
+	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/infrastructure/breaker"
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/infrastructure/idempotency"
+	"go-gin-gorm-example/infrastructure/lifecycle"
+	"go-gin-gorm-example/infrastructure/metrics"
+	"go-gin-gorm-example/infrastructure/middleware"
+	"go-gin-gorm-example/migrations"
+	"go-gin-gorm-example/module/health"
+	"go-gin-gorm-example/module/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the article module serve the articles on /api/v1/articles, the commands build the article service
+// with MakeArticle
+func init() {
+	boot.RegisterModule(module())
+}
+
+// Article is the article repository of database.driver and its service, built on the dependencies.
+type Article struct {
+	Repository RepositoryInterface
+	Transactor database.Transactor
+	Service    InterfaceService
+	// Breaker is nil unless circuitBreaker.database.enableCircuitBreaker is set with a database
+	Breaker *breaker.Breaker
+}
+
+// MakeArticle build the article repository of database.driver on dependencies and its service,
+// the in-memory repository is stopped by dependencies.Lifecycle.
+func MakeArticle(dependencies boot.Dependencies) (Article, error) {
+	var articles Article
+	switch config.Conf.DatabaseDriver() {
+	case config.DriverPostgres:
+		articles.Repository = NewRepositoryWithReplicas(dependencies.DB.DbConn, dependencies.DB.Replicas)
+		articles.Transactor = database.NewTransactor(dependencies.DB.DbConn)
+	case config.DriverSQLite:
+		articles.Repository = NewSQLiteRepository(dependencies.DB.DbConn)
+		articles.Transactor = database.NewTransactor(dependencies.DB.DbConn)
+	default:
+		inMemoryRepository := NewInMemoryRepository()
+		if err := inMemoryRepository.LockSnapshot(config.Conf.InMemory.SnapshotPath); err != nil {
+			return Article{}, fmt.Errorf("lock in-memory snapshot, stop the process using it first: %w", err)
+		}
+		inMemoryRepository.SetSnapshotRetention(config.Conf.InMemory.SnapshotRetention)
+		inMemoryRepository.StartSnapshotLoop(config.Conf.InMemory.SnapshotInterval)
+		if config.Conf.InMemory.WAL.EnableWAL {
+			if err := inMemoryRepository.OpenWAL(config.Conf.InMemory.WAL); err != nil {
+				_ = inMemoryRepository.Close()
+				return Article{}, fmt.Errorf("open write-ahead log: %w", err)
+			}
+		}
+		//the snapshot is saved before, so the write-ahead log is synced and closed last
+		dependencies.Lifecycle.Append(lifecycle.Hook{
+			Name:     "snapshot loop",
+			Priority: lifecycle.PriorityBackground,
+			Timeout:  config.Conf.Shutdown.HookTimeout,
+			OnStop: func(ctx context.Context) error {
+				inMemoryRepository.StopSnapshotLoop()
+				return nil
+			},
+		})
+		dependencies.Lifecycle.Append(lifecycle.Hook{
+			Name:     "in-memory repository",
+			Priority: lifecycle.PriorityClose,
+			Timeout:  config.Conf.Shutdown.HookTimeout,
+			OnStop: func(ctx context.Context) error {
+				return inMemoryRepository.Close()
+			},
+		})
+		articles.Repository = inMemoryRepository
+		articles.Transactor = database.NewInMemoryTransactor()
+	}
+
+	//fail fast while the database is slow or failing
+	if config.Conf.DatabaseEnabled() && config.Conf.CircuitBreaker.Database.EnableCircuitBreaker {
+		articles.Breaker = breaker.New("database", config.Conf.CircuitBreaker.Database, IsRepositoryFailure)
+		articles.Repository = NewBreakerRepository(articles.Repository, articles.Breaker)
+	}
+
+	articles.Service = NewService(articles.Repository, articles.Transactor, dependencies.RedisLib)
+	return articles, nil
+}
+
+// module serve the articles on /api/v1/articles.
+func module() boot.Module {
+	var articleHttp InterfaceHttp
+	var idempotencyStore idempotency.Store
+	return boot.Module{
+		Name:       "article",
+		Migrations: migrations.FS,
+		Setup: func(ctx *boot.ModuleContext) error {
+			articles, err := MakeArticle(ctx.Dependencies)
+			if err != nil {
+				return err
+			}
+			articleHttp = NewHttp(articles.Service)
+			idempotencyStore = ctx.Idempotency
+			config.Subscribe("article cache", func(conf config.Config) error {
+				articles.Service.SetCacheTTL(conf.Redis.CacheTTL)
+				return nil
+			}, "redis.cacheTTL")
+			if articles.Breaker != nil {
+				ctx.HealthCheckers = append(ctx.HealthCheckers, health.NewBreakerChecker(articles.Breaker))
+			}
+			if config.Conf.DatabaseEnabled() {
+				return nil
+			}
+
+			ctx.HealthCheckers = append(ctx.HealthCheckers, health.NewSnapshotChecker(config.Conf.InMemory.SnapshotPath))
+			if config.Conf.Metrics.EnableMetrics {
+				err = metrics.RegisterGauge("inmemory_articles", "Number of articles stored by the in-memory repository.", func() float64 {
+					count, _ := articles.Repository.CountArticle(context.Background(), primitive.ParameterFindArticle{})
+					return float64(count)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			//load the snapshot before serving, save it once the requests in flight are drained
+			ctx.Lifecycle.Append(lifecycle.Hook{
+				Name:     "snapshot",
+				Priority: lifecycle.PriorityFlush,
+				Timeout:  config.Conf.Shutdown.HookTimeout,
+				OnStart: func(ctx context.Context) error {
+					return articleHttp.LoadFromFile()
+				},
+				OnStop: func(ctx context.Context) error {
+					return articleHttp.SaveToFile()
+				},
+			})
+			return nil
+		},
+		Routes: func(routes boot.Routes) {
+			//only the creation is made safe to retry, the import is not buffered for a fingerprint
+			var createMiddlewares []gin.HandlerFunc
+			if idempotencyStore != nil {
+				createMiddlewares = append(createMiddlewares, middleware.IdempotencyMiddleware(idempotencyStore, config.Conf.Idempotency.TTL, config.Conf.Idempotency.InFlightTTL))
+			}
+			articleHttp.GroupArticle(routes.V1.Group("/articles"), createMiddlewares...)
+		},
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"go-gin-gorm-example/infrastructure/database"
 	"go-gin-gorm-example/module/primitive"
+	"go-gin-gorm-example/utils"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RepositoryInterface interface {
@@ -16,6 +20,10 @@ type RepositoryInterface interface {
 	CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (int64, error)
 	FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) ([]primitive.Article, error)
 	FindArticleByID(ctx context.Context, articleID int64) (primitive.Article, error)
+	DeleteArticle(ctx context.Context, articleID int64) error
+	CreateArticles(ctx context.Context, payload []primitive.Article) ([]primitive.Article, error)
+	UpsertArticles(ctx context.Context, payload []primitive.Article) error
+	ResetIDSequence(ctx context.Context) error
 	SetParamQueryToOrderByQuery(orderBy string) string
 	SaveToFile(filePath string) error
 	LoadFromFile(filePath string) error
@@ -23,16 +31,35 @@ type RepositoryInterface interface {
 
 type Repository struct {
 	db *gorm.DB
+	// replicas serve the reads when set, the writes always go to db
+	replicas *database.ReplicaSet
+	// likeOperator is the case-insensitive LIKE of the dialect
+	likeOperator string
 }
 
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{
-		db: db,
+		db:           db,
+		likeOperator: "ILIKE",
 	}
 }
 
+// NewRepositoryWithReplicas creates a Repository reading from the read replicas.
+func NewRepositoryWithReplicas(db *gorm.DB, replicas *database.ReplicaSet) *Repository {
+	repository := NewRepository(db)
+	repository.replicas = replicas
+	return repository
+}
+
+// reader return the connection of the reads, a replica when there is one available.
+func (r *Repository) reader(ctx context.Context) *gorm.DB {
+	return r.replicas.Reader(ctx, r.db)
+}
+
+// CreateArticle inserts the article, the id is assigned by the database.
 func (r *Repository) CreateArticle(ctx context.Context, payload primitive.Article) (primitive.Article, error) {
-	if err := r.db.WithContext(ctx).Table("articles").Omit("deleted_at").Create(&payload).Error; err != nil {
+	payload.ID = 0
+	if err := database.Conn(ctx, r.db).Table("articles").Omit("deleted_at").Create(&payload).Error; err != nil {
 		return payload, err
 	}
 	return payload, nil
@@ -40,14 +67,8 @@ func (r *Repository) CreateArticle(ctx context.Context, payload primitive.Articl
 
 func (r *Repository) CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (int64, error) {
 	var count int64
-	query := r.db.WithContext(ctx).Table("articles")
-	query.Where(`"deleted_at" is null`)
-	if param.Author != "" {
-		query.Where(`"author" ILIKE ?`, "%"+param.Author+"%")
-	}
-	if param.Query != "" {
-		query.Where(`"title" ILIKE ? or "body" ILIKE ?`, "%"+param.Query+"%", "%"+param.Query+"%")
-	}
+	query := r.reader(ctx).Table("articles")
+	r.filterArticles(query, param)
 	err := query.Count(&count).Error
 	if err != nil {
 		return 0, err
@@ -57,17 +78,20 @@ func (r *Repository) CountArticle(ctx context.Context, param primitive.Parameter
 
 func (r *Repository) FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) ([]primitive.Article, error) {
 	var listData []primitive.Article
-	query := r.db.WithContext(ctx).Table("articles")
-	query.Where(`"deleted_at" is null`)
-	if param.Author != "" {
-		query.Where(`"author" ILIKE ?`, "%"+param.Author+"%")
+	query := r.reader(ctx).Table("articles")
+	r.filterArticles(query, param)
+	// SortBy is usually already mapped by SetParamQueryToOrderByQuery, anything else fallback to the default column
+	sortBy := param.SortBy
+	if !utils.Contains([]string{"id", "author", "title", "body", "created_at"}, sortBy) {
+		sortBy = r.SetParamQueryToOrderByQuery(param.SortBy)
 	}
-	if param.Query != "" {
-		query.Where(`"title" ILIKE ? or "body" ILIKE ?`, "%"+param.Query+"%", "%"+param.Query+"%")
+	sortOrder := "asc"
+	if strings.EqualFold(param.SortOrder, "desc") {
+		sortOrder = "desc"
 	}
 	err := query.Offset(param.Offset).
 		Limit(param.PageSize).
-		Order(strings.Join([]string{param.SortBy, param.SortOrder}, " ")).
+		Order(strings.Join([]string{sortBy, sortOrder}, " ")).
 		Find(&listData).
 		Error
 	if err != nil {
@@ -76,6 +100,27 @@ func (r *Repository) FindListArticle(ctx context.Context, param primitive.Parame
 	return listData, nil
 }
 
+// filterArticles add the conditions of param shared by the count and the list,
+// the filters are a case-insensitive contains where % and _ have no special meaning.
+func (r *Repository) filterArticles(query *gorm.DB, param primitive.ParameterFindArticle) {
+	if !param.WithDeleted {
+		query.Where(`"deleted_at" is null`)
+	}
+	if param.Author != "" {
+		query.Where(fmt.Sprintf(`"author" %s ? escape '\'`, r.likeOperator), containsPattern(param.Author))
+	}
+	if param.Query != "" {
+		query.Where(fmt.Sprintf(`"title" %[1]s ? escape '\' or "body" %[1]s ? escape '\'`, r.likeOperator), containsPattern(param.Query), containsPattern(param.Query))
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern return the LIKE pattern matching the value anywhere.
+func containsPattern(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
+
 func (r *Repository) SetParamQueryToOrderByQuery(orderBy string) string {
 	var result string
 	switch orderBy {
@@ -97,17 +142,98 @@ func (r *Repository) SetParamQueryToOrderByQuery(orderBy string) string {
 
 func (r *Repository) FindArticleByID(ctx context.Context, articleID int64) (primitive.Article, error) {
 	var data primitive.Article
-	err := r.db.WithContext(ctx).
+	err := r.reader(ctx).
 		Table("articles").
 		Where(`"deleted_at" is null and id = ?`, articleID).
 		First(&data).
 		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return primitive.Article{}, primitive.ErrorArticleNotFound
+	}
 	if err != nil {
 		return primitive.Article{}, err
 	}
 	return data, nil
 }
 
+// CreateArticles inserts the articles in one batch, the ids are assigned by the database.
+func (r *Repository) CreateArticles(ctx context.Context, payload []primitive.Article) ([]primitive.Article, error) {
+	if len(payload) == 0 {
+		return payload, nil
+	}
+	for i := range payload {
+		payload[i].ID = 0
+	}
+	if err := database.Conn(ctx, r.db).Table("articles").Omit("deleted_at").CreateInBatches(&payload, len(payload)).Error; err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// UpsertArticles inserts the articles in one batch keeping their ids and deleted_at,
+// an existing article with the same id is overwritten and restored if it was deleted.
+func (r *Repository) UpsertArticles(ctx context.Context, payload []primitive.Article) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"author", "title", "body", "created_at", "updated_at"}),
+	}
+	onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+		Column: clause.Column{Name: "deleted_at"},
+		Value:  nil,
+	})
+	err := database.Conn(ctx, r.db).
+		Table("articles").
+		Omit("deleted_at").
+		Clauses(onConflict).
+		CreateInBatches(&payload, len(payload)).
+		Error
+	if err != nil {
+		return err
+	}
+
+	//a zero DeletedAt is written as null above, the deleted articles are deleted again after
+	for _, article := range payload {
+		if article.DeletedAt.IsZero() {
+			continue
+		}
+		err = database.Conn(ctx, r.db).
+			Table("articles").
+			Where("id = ?", article.ID).
+			Update("deleted_at", article.DeletedAt).
+			Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetIDSequence move the serial sequence of id after the highest id,
+// needed after articles are inserted with their own ids.
+func (r *Repository) ResetIDSequence(ctx context.Context) error {
+	return database.Conn(ctx, r.db).
+		Exec(`select setval(pg_get_serial_sequence('articles', 'id'), coalesce((select max(id) from articles), 0) + 1, false)`).
+		Error
+}
+
+// DeleteArticle soft deletes the article by filling deleted_at.
+func (r *Repository) DeleteArticle(ctx context.Context, articleID int64) error {
+	result := database.Conn(ctx, r.db).
+		Table("articles").
+		Where(`"deleted_at" is null and id = ?`, articleID).
+		Update("deleted_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return primitive.ErrorArticleNotFound
+	}
+	return nil
+}
+
 // SaveToFile saves the articles data to a JSON file.
 func (r *Repository) SaveToFile(filePath string) error {
 	return errors.New("save To File is not implemented when database postgres is enabled")
@@ -0,0 +1,103 @@
+package article
+
+import (
+	"context"
+	"errors"
+
+	"go-gin-gorm-example/infrastructure/breaker"
+	"go-gin-gorm-example/module/primitive"
+
+	"gorm.io/gorm"
+)
+
+// BreakerRepository call the database of repository through a circuit breaker, the calls fail
+// with breaker.ErrOpen without waiting on the database while the breaker is open.
+type BreakerRepository struct {
+	repository RepositoryInterface
+	breaker    *breaker.Breaker
+}
+
+func NewBreakerRepository(repository RepositoryInterface, b *breaker.Breaker) *BreakerRepository {
+	return &BreakerRepository{
+		repository: repository,
+		breaker:    b,
+	}
+}
+
+// IsRepositoryFailure return true when err is a failure of the database, a missing article
+// or a request cancelled by the client is not.
+func IsRepositoryFailure(err error) bool {
+	return !errors.Is(err, primitive.ErrorArticleNotFound) &&
+		!errors.Is(err, gorm.ErrRecordNotFound) &&
+		!errors.Is(err, context.Canceled)
+}
+
+func (r *BreakerRepository) CreateArticle(ctx context.Context, payload primitive.Article) (data primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.CreateArticle(ctx, payload)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) CountArticle(ctx context.Context, param primitive.ParameterFindArticle) (count int64, err error) {
+	err = r.breaker.Execute(func() error {
+		count, err = r.repository.CountArticle(ctx, param)
+		return err
+	})
+	return count, err
+}
+
+func (r *BreakerRepository) FindListArticle(ctx context.Context, param primitive.ParameterFindArticle) (list []primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		list, err = r.repository.FindListArticle(ctx, param)
+		return err
+	})
+	return list, err
+}
+
+func (r *BreakerRepository) FindArticleByID(ctx context.Context, articleID int64) (data primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		data, err = r.repository.FindArticleByID(ctx, articleID)
+		return err
+	})
+	return data, err
+}
+
+func (r *BreakerRepository) DeleteArticle(ctx context.Context, articleID int64) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.DeleteArticle(ctx, articleID)
+	})
+}
+
+func (r *BreakerRepository) CreateArticles(ctx context.Context, payload []primitive.Article) (list []primitive.Article, err error) {
+	err = r.breaker.Execute(func() error {
+		list, err = r.repository.CreateArticles(ctx, payload)
+		return err
+	})
+	return list, err
+}
+
+func (r *BreakerRepository) UpsertArticles(ctx context.Context, payload []primitive.Article) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.UpsertArticles(ctx, payload)
+	})
+}
+
+func (r *BreakerRepository) ResetIDSequence(ctx context.Context) error {
+	return r.breaker.Execute(func() error {
+		return r.repository.ResetIDSequence(ctx)
+	})
+}
+
+func (r *BreakerRepository) SetParamQueryToOrderByQuery(orderBy string) string {
+	return r.repository.SetParamQueryToOrderByQuery(orderBy)
+}
+
+func (r *BreakerRepository) SaveToFile(filePath string) error {
+	return r.repository.SaveToFile(filePath)
+}
+
+func (r *BreakerRepository) LoadFromFile(filePath string) error {
+	return r.repository.LoadFromFile(filePath)
+}
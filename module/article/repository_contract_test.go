@@ -0,0 +1,109 @@
+package article_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/migrations"
+	"go-gin-gorm-example/module/article"
+	"go-gin-gorm-example/module/article/articletest"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// postgresDSNEnv is the dsn of a disposable postgres database, the contract is skipped on postgres without it
+// and fails on the CI, which set it. `make test-postgres` start one with docker and run the contract:
+//
+//	docker run --rm -e POSTGRES_PASSWORD=postgres -p 5432:5432 postgres
+//	ARTICLE_TEST_POSTGRES_DSN="host=localhost user=postgres password=postgres sslmode=disable" go test ./module/article/...
+const postgresDSNEnv = "ARTICLE_TEST_POSTGRES_DSN"
+
+func TestInMemoryRepositoryContract(t *testing.T) {
+	articletest.RunRepositoryContract(t, func(t *testing.T) article.RepositoryInterface {
+		return newInMemoryRepository(t)
+	})
+	articletest.RunTransactionContract(t, func(t *testing.T) (article.RepositoryInterface, database.Transactor) {
+		return newInMemoryRepository(t), database.NewInMemoryTransactor()
+	})
+}
+
+func TestSQLiteRepositoryContract(t *testing.T) {
+	articletest.RunRepositoryContract(t, func(t *testing.T) article.RepositoryInterface {
+		return article.NewSQLiteRepository(openSQLite(t))
+	})
+	articletest.RunTransactionContract(t, func(t *testing.T) (article.RepositoryInterface, database.Transactor) {
+		db := openSQLite(t)
+		return article.NewSQLiteRepository(db), database.NewTransactor(db)
+	})
+}
+
+func TestPostgresRepositoryContract(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" && os.Getenv("CI") != "" {
+		t.Fatalf("%s is not set, the CI must run the contract on postgres", postgresDSNEnv)
+	}
+	if dsn == "" {
+		t.Skipf("%s is not set, run make test-postgres", postgresDSNEnv)
+	}
+
+	articletest.RunRepositoryContract(t, func(t *testing.T) article.RepositoryInterface {
+		return article.NewRepository(openPostgres(t, dsn))
+	})
+	articletest.RunTransactionContract(t, func(t *testing.T) (article.RepositoryInterface, database.Transactor) {
+		db := openPostgres(t, dsn)
+		return article.NewRepository(db), database.NewTransactor(db)
+	})
+}
+
+func newInMemoryRepository(t *testing.T) *article.InMemoryRepository {
+	repository := article.NewInMemoryRepository()
+	t.Cleanup(func() {
+		_ = repository.Close()
+	})
+	return repository
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	conf := config.Config{}
+	conf.Database.SQLite.Path = ":memory:"
+	conf.Database.SQLite.AutoMigrate = true
+	db, err := database.NewSQLiteClient(&conf)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	closeDB(t, db.DbConn)
+	return db.DbConn
+}
+
+// openPostgres return a connection to an empty and migrated articles table.
+func openPostgres(t *testing.T, dsn string) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	closeDB(t, db)
+
+	migrator, err := database.NewMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("read migrations: %v", err)
+	}
+	if err = migrator.Up(context.Background()); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	if err = db.Exec(`truncate table articles restart identity`).Error; err != nil {
+		t.Fatalf("truncate articles: %v", err)
+	}
+	return db
+}
+
+func closeDB(t *testing.T, db *gorm.DB) {
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
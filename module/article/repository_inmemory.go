@@ -2,14 +2,21 @@ package article
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
 	"go-gin-gorm-example/module/primitive"
+	"go-gin-gorm-example/utils"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // InMemoryRepository is an in-memory implementation of the RepositoryInterface.
@@ -17,6 +24,24 @@ type InMemoryRepository struct {
 	articles   []primitive.Article
 	idSequence int64
 	mu         sync.RWMutex
+
+	// wal is nil unless OpenWAL is called, snapshotPath is the file given to LoadFromFile
+	// which the write-ahead log is compacted into.
+	wal               *writeAheadLog
+	walConf           config.WALConfig
+	snapshotPath      string
+	snapshotRetention int
+	// snapshotLock is the lock file of LockSnapshot, kept open until Close
+	snapshotLock *os.File
+	// mutations count the changes, savedMutations is its value at the last snapshot
+	mutations      int64
+	savedMutations atomic.Int64
+	compact        chan struct{}
+	stop           chan struct{}
+	stopOnce       sync.Once
+	// intervals change the interval of the snapshot loop, which is started once by loopOnce
+	intervals chan time.Duration
+	loopOnce  sync.Once
 }
 
 // NewInMemoryRepository creates a new instance of InMemoryRepository.
@@ -24,6 +49,9 @@ func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
 		articles:   make([]primitive.Article, 0),
 		idSequence: 1,
+		compact:    make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		intervals:  make(chan time.Duration, 1),
 	}
 }
 
@@ -36,11 +64,21 @@ func (r *InMemoryRepository) CreateArticle(ctx context.Context, payload primitiv
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	payload.ID = nextID(r.articles)
-	payload.CreatedAt = time.Now()
-	payload.UpdatedAt = time.Now()
-	r.idSequence++
+	payload.ID = r.idSequence
+	if payload.CreatedAt.IsZero() {
+		payload.CreatedAt = time.Now()
+	}
+	if payload.UpdatedAt.IsZero() {
+		payload.UpdatedAt = time.Now()
+	}
+	payload.DeletedAt = time.Time{}
+
+	if err := r.logMutation(payload); err != nil {
+		return primitive.Article{}, err
+	}
+	r.recordUndo(ctx, payload.ID)
 
+	r.idSequence++
 	r.articles = append(r.articles, payload)
 	return payload, nil
 }
@@ -51,8 +89,7 @@ func (r *InMemoryRepository) CountArticle(ctx context.Context, param primitive.P
 
 	var count int64
 	for _, article := range r.articles {
-		if article.DeletedAt.IsZero() && (param.Author == "" || strings.Contains(article.Author, param.Author)) &&
-			(param.Query == "" || strings.Contains(article.Title, param.Query) || strings.Contains(article.Body, param.Query)) {
+		if matchArticle(article, param) {
 			count++
 		}
 	}
@@ -63,31 +100,53 @@ func (r *InMemoryRepository) FindListArticle(ctx context.Context, param primitiv
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var listData []primitive.Article
+	listData := make([]primitive.Article, 0)
 	for _, article := range r.articles {
-		if article.DeletedAt.IsZero() && (param.Author == "" || strings.Contains(article.Author, param.Author)) &&
-			(param.Query == "" || strings.Contains(article.Title, param.Query) || strings.Contains(article.Body, param.Query)) {
+		if matchArticle(article, param) {
 			listData = append(listData, article)
 		}
 	}
 
-	// Apply sorting
-	sortField := r.SetParamQueryToOrderByQuery(param.SortBy)
-	if param.SortOrder == "desc" {
-		sortField = "-" + sortField
+	// Apply sorting, SortBy is usually already mapped by SetParamQueryToOrderByQuery
+	sortField := param.SortBy
+	if !utils.Contains([]string{"ID", "Author", "Title", "Body", "CreatedAt"}, sortField) {
+		sortField = r.SetParamQueryToOrderByQuery(param.SortBy)
 	}
+	listData = sortArticles(listData, sortField, strings.EqualFold(param.SortOrder, "desc"))
 
-	listData = sortArticles(listData, sortField)
-
-	// Apply pagination
+	// Apply pagination the way the sql LIMIT and OFFSET do, a page out of range is empty
 	startIdx := param.Offset
-	endIdx := param.Offset + param.PageSize
-	if endIdx > len(listData) {
-		endIdx = len(listData)
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	if startIdx > len(listData) {
+		startIdx = len(listData)
+	}
+	endIdx := len(listData)
+	if param.PageSize >= 0 && startIdx+param.PageSize < endIdx {
+		endIdx = startIdx + param.PageSize
 	}
 	return listData[startIdx:endIdx], nil
 }
 
+// matchArticle apply the filters of param like the sql repository, a case-insensitive contains.
+func matchArticle(article primitive.Article, param primitive.ParameterFindArticle) bool {
+	if !param.WithDeleted && !article.DeletedAt.IsZero() {
+		return false
+	}
+	if param.Author != "" && !containsFold(article.Author, param.Author) {
+		return false
+	}
+	if param.Query != "" && !containsFold(article.Title, param.Query) && !containsFold(article.Body, param.Query) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
 func (r *InMemoryRepository) SetParamQueryToOrderByQuery(orderBy string) string {
 	switch orderBy {
 	case "id":
@@ -117,98 +176,478 @@ func (r *InMemoryRepository) FindArticleByID(ctx context.Context, articleID int6
 	return primitive.Article{}, primitive.ErrorArticleNotFound
 }
 
-// SaveToFile saves the articles data to a JSON file.
+// CreateArticles appends the articles with new ids.
+func (r *InMemoryRepository) CreateArticles(ctx context.Context, payload []primitive.Article) ([]primitive.Article, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.idSequence
+	now := time.Now()
+	for i := range payload {
+		payload[i].ID = id
+		if payload[i].CreatedAt.IsZero() {
+			payload[i].CreatedAt = now
+		}
+		if payload[i].UpdatedAt.IsZero() {
+			payload[i].UpdatedAt = now
+		}
+		payload[i].DeletedAt = time.Time{}
+		id++
+	}
+
+	if err := r.logMutation(payload...); err != nil {
+		return nil, err
+	}
+	r.recordUndo(ctx, articleIDs(payload)...)
+
+	r.idSequence = id
+	r.articles = append(r.articles, payload...)
+	return payload, nil
+}
+
+// UpsertArticles stores the articles keeping their ids and DeletedAt,
+// an existing article with the same id is overwritten and restored if it was deleted.
+func (r *InMemoryRepository) UpsertArticles(ctx context.Context, payload []primitive.Article) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	articles := make([]primitive.Article, 0, len(payload))
+	for _, article := range payload {
+		if article.CreatedAt.IsZero() {
+			article.CreatedAt = now
+		}
+		if article.UpdatedAt.IsZero() {
+			article.UpdatedAt = now
+		}
+		articles = append(articles, article)
+	}
+
+	if err := r.logMutation(articles...); err != nil {
+		return err
+	}
+	r.recordUndo(ctx, articleIDs(articles)...)
+
+	r.putArticles(articles)
+	return nil
+}
+
+// ResetIDSequence move the id sequence after the highest id.
+func (r *InMemoryRepository) ResetIDSequence(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.idSequence = nextID(r.articles)
+	return nil
+}
+
+// DeleteArticle soft deletes the article by filling DeletedAt.
+func (r *InMemoryRepository) DeleteArticle(ctx context.Context, articleID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.articles {
+		if r.articles[i].ID == articleID && r.articles[i].DeletedAt.IsZero() {
+			deleted := r.articles[i]
+			deleted.DeletedAt = time.Now()
+			if err := r.logMutation(deleted); err != nil {
+				return err
+			}
+			r.recordUndo(ctx, deleted.ID)
+			r.articles[i] = deleted
+			return nil
+		}
+	}
+	return primitive.ErrorArticleNotFound
+}
+
+// SaveToFile atomically saves the articles data to a versioned JSON snapshot file.
 func (r *InMemoryRepository) SaveToFile(filePath string) error {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	data, err := json.MarshalIndent(r.articles, "", "  ")
+	err := writeSnapshot(filePath, r.articles, r.snapshotRetention)
 	if err != nil {
 		return err
 	}
+	r.savedMutations.Store(r.mutations)
 
-	err = os.WriteFile(filePath, data, 0644)
-	if err != nil {
-		return err
+	// the snapshot holds every mutation logged so far, writers are blocked by the read lock
+	if r.wal != nil {
+		return r.wal.Reset()
 	}
 
 	return nil
 }
 
-// LoadFromFile loads articles data from a JSON file.
+// LoadFromFile loads articles data from a JSON snapshot file, the snapshots are then saved into it.
+// A corrupted snapshot is moved aside so it is not overwritten, and the write-ahead log is replayed alone.
 func (r *InMemoryRepository) LoadFromFile(filePath string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
+	articles, err := readSnapshot(filePath)
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist):
+		// without snapshot every mutation since the start is still in the write-ahead log
+		articles = make([]primitive.Article, 0)
+	case errors.Is(err, errCorruptedSnapshot):
+		corruptPath, errMove := moveCorruptedSnapshot(filePath)
+		if errMove != nil {
+			return errors.Join(err, errMove)
+		}
+		log.Errorf("%v, it is moved to %s, restore it or a backup before the next snapshot to keep its articles", err, corruptPath)
+		articles = make([]primitive.Article, 0)
+	default:
 		return err
 	}
 
-	var articles []primitive.Article
-	err = json.Unmarshal(data, &articles)
+	r.articles = articles
+
+	if r.wal != nil {
+		//the last record of an article decide if it is put or removed
+		var order []int64
+		logged := make(map[int64]*primitive.Article)
+		replayed, err := r.wal.Replay(func(record walRecord) {
+			for i := range record.Articles {
+				article := record.Articles[i]
+				if _, ok := logged[article.ID]; !ok {
+					order = append(order, article.ID)
+				}
+				switch record.Op {
+				case walOpPut:
+					logged[article.ID] = &article
+				case walOpRemove:
+					logged[article.ID] = nil
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		put := make([]primitive.Article, 0, len(order))
+		removed := make(map[int64]bool)
+		for _, id := range order {
+			if article := logged[id]; article != nil {
+				put = append(put, *article)
+			} else {
+				removed[id] = true
+			}
+		}
+		r.removeArticles(removed)
+		r.putArticles(put)
+		log.Infof("replayed %d write-ahead log records on top of snapshot %s", replayed, filePath)
+	}
+	r.idSequence = nextID(r.articles)
+	//set once loaded, so a snapshot which failed to load is not overwritten by the next one
+	r.snapshotPath = filePath
+
+	return nil
+}
+
+// OpenWAL start logging every mutation to the write-ahead log, it must be called
+// before LoadFromFile so the log is replayed on top of the snapshot.
+// The snapshot loop then use the compact interval instead of the one of StartSnapshotLoop.
+func (r *InMemoryRepository) OpenWAL(conf config.WALConfig) error {
+	r.mu.Lock()
+	wal, err := openWriteAheadLog(conf.Path, conf.SyncPolicy, conf.SyncInterval)
 	if err != nil {
+		r.mu.Unlock()
 		return err
 	}
+	r.wal = wal
+	r.walConf = conf
+	r.mu.Unlock()
 
-	r.articles = articles
+	r.runSnapshotLoop(conf.CompactInterval)
+	return nil
+}
+
+// LockSnapshot take an exclusive lock on snapshotPath for the process until Close, it fails with
+// ErrFileLocked while another process, like the server and a command, use the same snapshot.
+func (r *InMemoryRepository) LockSnapshot(snapshotPath string) error {
+	//the snapshot is replaced on every save, so the lock is taken on a file next to it
+	lockPath := snapshotPath + snapshotLockSuffix
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err = lockFile(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("snapshot %s: %w", snapshotPath, err)
+	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.snapshotLock != nil {
+		_ = r.snapshotLock.Close()
+	}
+	r.snapshotLock = file
 	return nil
 }
 
-// Helper function to sort articles based on a given field.
-func sortArticles(articles []primitive.Article, field string) []primitive.Article {
-	switch field {
-	case "ID":
-		return sortByID(articles)
-	case "Author":
-		return sortByAuthor(articles)
-	case "Title":
-		return sortByTitle(articles)
-	case "Body":
-		return sortByBody(articles)
-	case "CreatedAt":
-		return sortByCreatedAt(articles)
-	default:
-		return sortByCreatedAt(articles)
+// SetSnapshotRetention keep the last retention snapshots as backup when a new one is saved.
+func (r *InMemoryRepository) SetSnapshotRetention(retention int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.snapshotRetention = retention
+}
+
+// StartSnapshotLoop save a snapshot into the file given to LoadFromFile every interval,
+// it does nothing once OpenWAL is called since the loop is on the compact interval.
+func (r *InMemoryRepository) StartSnapshotLoop(interval time.Duration) {
+	r.mu.RLock()
+	walOpen := r.wal != nil
+	r.mu.RUnlock()
+	if interval <= 0 || walOpen {
+		return
 	}
+	r.runSnapshotLoop(interval)
 }
 
-func sortByID(articles []primitive.Article) []primitive.Article {
-	sort.Slice(articles, func(i, j int) bool {
-		return articles[i].ID > articles[j].ID
+// StopSnapshotLoop stop the background snapshots, SaveToFile still save one.
+func (r *InMemoryRepository) StopSnapshotLoop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
 	})
-	return articles
 }
 
-func sortByAuthor(articles []primitive.Article) []primitive.Article {
-	sort.Slice(articles, func(i, j int) bool {
-		return strings.Compare(articles[i].Author, articles[j].Author) < 0
-	})
-	return articles
+// Close stop the background snapshots, then sync and close the write-ahead log and release the snapshot.
+func (r *InMemoryRepository) Close() error {
+	r.StopSnapshotLoop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	if r.wal != nil {
+		errs = append(errs, r.wal.Close())
+		r.wal = nil
+	}
+	if r.snapshotLock != nil {
+		errs = append(errs, r.snapshotLock.Close())
+		r.snapshotLock = nil
+	}
+	return errors.Join(errs...)
 }
 
-func sortByTitle(articles []primitive.Article) []primitive.Article {
-	sort.Slice(articles, func(i, j int) bool {
-		return strings.Compare(articles[i].Title, articles[j].Title) < 0
-	})
-	return articles
+// Compact write a fresh snapshot into the file given to LoadFromFile and empty the write-ahead log,
+// nothing is written when there is no change since the last snapshot.
+func (r *InMemoryRepository) Compact() error {
+	r.mu.RLock()
+	snapshotPath := r.snapshotPath
+	changed := r.mutations != r.savedMutations.Load()
+	r.mu.RUnlock()
+
+	if snapshotPath == "" || !changed {
+		return nil
+	}
+	return r.SaveToFile(snapshotPath)
+}
+
+// logMutation write the new state of the articles to the write-ahead log, the caller hold the write lock
+// and apply the mutation only when it succeed.
+func (r *InMemoryRepository) logMutation(articles ...primitive.Article) error {
+	return r.logRecord(walOpPut, articles)
+}
+
+// logRecord write the op of the articles to the write-ahead log like logMutation.
+func (r *InMemoryRepository) logRecord(op string, articles []primitive.Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+	r.mutations++
+	if r.wal == nil {
+		return nil
+	}
+	if err := r.wal.Append(walRecord{Op: op, Articles: articles}); err != nil {
+		return err
+	}
+	if r.walConf.CompactSize > 0 && r.wal.Size() >= r.walConf.CompactSize {
+		select {
+		case r.compact <- struct{}{}:
+		default:
+		}
+	}
+	return nil
 }
 
-func sortByBody(articles []primitive.Article) []primitive.Article {
-	sort.Slice(articles, func(i, j int) bool {
-		return strings.Compare(articles[i].Body, articles[j].Body) < 0
+// recordUndo register how to undo the change of the articles with ids when ctx is in a unit of work,
+// the caller hold the write lock and call it before applying the change.
+func (r *InMemoryRepository) recordUndo(ctx context.Context, ids ...int64) {
+	if len(ids) == 0 || !database.InUnitOfWork(ctx) {
+		return
+	}
+
+	changed := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		changed[id] = true
+	}
+	previous := make(map[int64]primitive.Article, len(ids))
+	for _, article := range r.articles {
+		if changed[article.ID] {
+			previous[article.ID] = article
+		}
+	}
+
+	database.OnRollback(ctx, func() error {
+		return r.undo(ids, previous)
 	})
-	return articles
 }
 
-func sortByCreatedAt(articles []primitive.Article) []primitive.Article {
-	sort.Slice(articles, func(i, j int) bool {
-		return articles[i].CreatedAt.Before(articles[j].CreatedAt)
+// undo put back the previous state of the articles with ids, an article which didn't exist
+// is removed like the sql rollback leave no row, and the id sequence move back after the highest id.
+func (r *InMemoryRepository) undo(ids []int64, previous map[int64]primitive.Article) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	undone := make([]primitive.Article, 0, len(ids))
+	var created []primitive.Article
+	for _, id := range ids {
+		if article, ok := previous[id]; ok {
+			undone = append(undone, article)
+			continue
+		}
+		for _, article := range r.articles {
+			if article.ID == id {
+				created = append(created, article)
+				break
+			}
+		}
+	}
+
+	if err := r.logRecord(walOpRemove, created); err != nil {
+		return err
+	}
+	removed := make(map[int64]bool, len(created))
+	for _, article := range created {
+		removed[article.ID] = true
+	}
+	r.removeArticles(removed)
+
+	if err := r.logMutation(undone...); err != nil {
+		return err
+	}
+	r.putArticles(undone)
+	return nil
+}
+
+// removeArticles drop the articles with the ids of removed, the caller hold the write lock.
+func (r *InMemoryRepository) removeArticles(removed map[int64]bool) {
+	if len(removed) == 0 {
+		return
+	}
+	kept := r.articles[:0]
+	for _, article := range r.articles {
+		if !removed[article.ID] {
+			kept = append(kept, article)
+		}
+	}
+	r.articles = kept
+	r.idSequence = nextID(r.articles)
+}
+
+// putArticles insert or replace the articles by id, the caller hold the write lock.
+func (r *InMemoryRepository) putArticles(articles []primitive.Article) {
+	indexByID := make(map[int64]int, len(r.articles))
+	for i, article := range r.articles {
+		indexByID[article.ID] = i
+	}
+	for _, article := range articles {
+		if i, ok := indexByID[article.ID]; ok {
+			r.articles[i] = article
+			continue
+		}
+		indexByID[article.ID] = len(r.articles)
+		r.articles = append(r.articles, article)
+	}
+	r.idSequence = nextID(r.articles)
+}
+
+// runSnapshotLoop start the snapshot loop on interval, or move the running one to interval,
+// so a single loop snapshot the articles.
+func (r *InMemoryRepository) runSnapshotLoop(interval time.Duration) {
+	r.loopOnce.Do(func() { go r.snapshotLoop() })
+	//only the last interval matter, replace the one not read yet
+	select {
+	case <-r.intervals:
+	default:
+	}
+	r.intervals <- interval
+}
+
+// snapshotLoop save a snapshot every interval and whenever the write-ahead log
+// grows over its compact size, until Close is called.
+func (r *InMemoryRepository) snapshotLoop() {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case interval := <-r.intervals:
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			}
+			if interval > 0 {
+				ticker = time.NewTicker(interval)
+				tick = ticker.C
+			}
+			continue
+		case <-tick:
+		case <-r.compact:
+		}
+		if err := r.Compact(); err != nil {
+			log.Errorf("failed save snapshot of the in-memory repository: %v", err)
+		}
+	}
+}
+
+// Helper function to sort articles based on a given field, in descending order when desc is true.
+func sortArticles(articles []primitive.Article, field string, desc bool) []primitive.Article {
+	less := lessArticle(field)
+	sort.SliceStable(articles, func(i, j int) bool {
+		if desc {
+			return less(articles[j], articles[i])
+		}
+		return less(articles[i], articles[j])
 	})
 	return articles
 }
 
+func lessArticle(field string) func(a, b primitive.Article) bool {
+	switch field {
+	case "ID":
+		return func(a, b primitive.Article) bool {
+			return a.ID < b.ID
+		}
+	case "Author":
+		return func(a, b primitive.Article) bool {
+			return strings.Compare(a.Author, b.Author) < 0
+		}
+	case "Title":
+		return func(a, b primitive.Article) bool {
+			return strings.Compare(a.Title, b.Title) < 0
+		}
+	case "Body":
+		return func(a, b primitive.Article) bool {
+			return strings.Compare(a.Body, b.Body) < 0
+		}
+	default:
+		return func(a, b primitive.Article) bool {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	}
+}
+
 // Helper function to determine the next ID based on the highest ID in the loaded articles
 func nextID(articles []primitive.Article) int64 {
 	var maxID int64
@@ -220,6 +659,14 @@ func nextID(articles []primitive.Article) int64 {
 	return maxID + 1
 }
 
+func articleIDs(articles []primitive.Article) []int64 {
+	ids := make([]int64, 0, len(articles))
+	for _, article := range articles {
+		ids = append(ids, article.ID)
+	}
+	return ids
+}
+
 func findMaxID(articles []primitive.Article) int64 {
 	var maxID int64
 	for _, article := range articles {
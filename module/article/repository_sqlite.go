@@ -0,0 +1,44 @@
+package article
+
+import (
+	"context"
+	"errors"
+
+	"go-gin-gorm-example/infrastructure/database"
+
+	"gorm.io/gorm"
+)
+
+// SQLiteRepository store the articles in an embedded sqlite database, it shares the queries
+// of Repository and only differs where the sql of sqlite differs from postgres.
+type SQLiteRepository struct {
+	*Repository
+}
+
+func NewSQLiteRepository(db *gorm.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		Repository: &Repository{
+			db: db,
+			// LIKE of sqlite is case-insensitive for the ascii characters
+			likeOperator: "LIKE",
+		},
+	}
+}
+
+// ResetIDSequence move the autoincrement sequence of id to the highest id,
+// needed after articles are inserted with their own ids.
+func (r *SQLiteRepository) ResetIDSequence(ctx context.Context) error {
+	return database.Conn(ctx, r.db).
+		Exec(`update sqlite_sequence set seq = (select coalesce(max(id), 0) from articles) where name = 'articles'`).
+		Error
+}
+
+// SaveToFile saves the articles data to a JSON file.
+func (r *SQLiteRepository) SaveToFile(filePath string) error {
+	return errors.New("save To File is not implemented when database sqlite is enabled")
+}
+
+// LoadFromFile loads articles data from a JSON file.
+func (r *SQLiteRepository) LoadFromFile(filePath string) error {
+	return errors.New("load From File is not implemented when database sqlite is enabled")
+}
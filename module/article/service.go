@@ -3,47 +3,80 @@ package article
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"go-gin-gorm-example/infrastructure/config"
+	"go-gin-gorm-example/infrastructure/database"
 	"go-gin-gorm-example/infrastructure/httplib"
 	logger "go-gin-gorm-example/infrastructure/log"
+	"go-gin-gorm-example/infrastructure/metrics"
 	"go-gin-gorm-example/infrastructure/redis"
+	"go-gin-gorm-example/infrastructure/tracing"
+	"go-gin-gorm-example/infrastructure/validator"
 	"go-gin-gorm-example/module/primitive"
 	"go-gin-gorm-example/utils"
 )
 
 const (
 	redisFinaleKeyArticle     = "article:%d"
+	redisPatternKeyArticle    = "article:*"
 	redisListFinaleKeyArticle = "article_list"
+	defaultCacheTTL           = time.Minute
 )
 
 type InterfaceService interface {
 	GetListArticle(ctx context.Context, param primitive.ParameterArticleHandler, pagination *httplib.Query) (resp []primitive.ArticleResp, count int64, err error)
 	RecordArticle(ctx context.Context, payload primitive.ArticleReq) (primitive.ArticleResp, error)
 	GetDetailArticle(ctx context.Context, articleID int64) (primitive.ArticleResp, error)
-	RecordArticleToFile(ctx context.Context)
-	LoadArticleToFile(ctx context.Context)
+	DeleteArticle(ctx context.Context, articleID int64) error
+	ExportArticle(ctx context.Context, w io.Writer, format string) (int, error)
+	ImportArticle(ctx context.Context, r io.Reader, param primitive.ParameterImportArticle) (primitive.ImportArticleResp, error)
+	RecordArticleToFile(ctx context.Context) error
+	LoadArticleToFile(ctx context.Context) error
+	SetCacheTTL(ttl time.Duration)
 }
 
 type Service struct {
 	repository RepositoryInterface
+	transactor database.Transactor
 	redis      redis.LibInterface
+	cacheTTL   *atomic.Int64
 }
 
-func NewService(repository RepositoryInterface, redisLib redis.LibInterface) InterfaceService {
+func NewService(repository RepositoryInterface, transactor database.Transactor, redisLib redis.LibInterface) InterfaceService {
 	if repository == nil {
 		panic("repository is not implemented!")
 	}
-	return &Service{
+	if transactor == nil {
+		panic("transactor is not implemented!")
+	}
+	service := &Service{
 		repository: repository,
+		transactor: transactor,
 		redis:      redisLib,
+		cacheTTL:   &atomic.Int64{},
+	}
+	service.SetCacheTTL(config.Conf.Redis.CacheTTL)
+	return service
+}
+
+// SetCacheTTL change how long the articles are cached on redis, 0 is 1m.
+func (s Service) SetCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
 	}
+	s.cacheTTL.Store(int64(ttl))
 }
 
-func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq) (primitive.ArticleResp, error) {
+func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq) (resp primitive.ArticleResp, err error) {
 	logCtx := fmt.Sprintf("service.RecordArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
 
 	payloadDb := primitive.Article{
 		Author: payload.Author,
@@ -59,13 +92,16 @@ func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq
 
 	//set data to redis on goroutine
 	if config.Conf.Redis.EnableRedis && s.redis != nil {
+		//the cache is written after the response, keep the trace but not the cancellation of the request
+		ctxCache := context.WithoutCancel(ctx)
 		go func() {
 			dataBytes, errMarshall := json.Marshal(data)
 			if errMarshall != nil {
 				logger.Error(ctx, utils.ErrorLogFormat, errMarshall.Error(), logCtx, "json.Marshal")
 			}
 			redisFinaleKey := fmt.Sprintf(redisFinaleKeyArticle, data.ID)
-			errSetToRedis := s.redis.Set(redisFinaleKey, dataBytes, time.Minute)
+			errSetToRedis := s.redis.Set(ctxCache, redisFinaleKey, dataBytes, time.Duration(s.cacheTTL.Load()))
+			metrics.ObserveCacheWrite(metrics.CacheSet, errSetToRedis)
 			if errSetToRedis != nil {
 				logger.Error(ctx, utils.ErrorLogFormat, errSetToRedis.Error(), logCtx, "s.redis.Set")
 			}
@@ -88,6 +124,8 @@ func (s Service) RecordArticle(ctx context.Context, payload primitive.ArticleReq
 
 func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterArticleHandler, pagination *httplib.Query) (resp []primitive.ArticleResp, count int64, err error) {
 	logCtx := fmt.Sprintf("service.GetListArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
 
 	emptySliceDataArticle := make([]primitive.ArticleResp, 0)
 
@@ -112,7 +150,12 @@ func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterAr
 
 	// Check if the data exists in the Redis cache
 	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		cacheData := s.redis.Get(cacheKey)
+		cacheData, errGetFromRedis := s.redis.Get(ctx, cacheKey)
+		metrics.ObserveCacheGet(cacheData != "", errGetFromRedis)
+		if errGetFromRedis != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errGetFromRedis.Error(), logCtx, "s.redis.Get")
+		}
+		logger.Debug(ctx, logCtx, "cache key %s, hit: %t", cacheKey, cacheData != "")
 		if cacheData != "" {
 			// If data exists in cache, decode it and return
 			if err := json.Unmarshal([]byte(cacheData), &resp); err != nil {
@@ -124,6 +167,8 @@ func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterAr
 	}
 
 	// Data not found in cache, query the database
+	logger.Debug(ctx, logCtx, "find articles with query: %q, author: %q, size: %d, offset: %d",
+		paramQuery.Query, paramQuery.Author, paramQuery.PageSize, paramQuery.Offset)
 	count, err = s.repository.CountArticle(ctx, paramQuery)
 	if err != nil {
 		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "u.repository.CountArticle")
@@ -158,15 +203,18 @@ func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterAr
 	// Store data in Redis cache for next time
 	if config.Conf.Redis.EnableRedis && s.redis != nil {
 		if len(resp) > 0 {
+			//the cache is written after the response, keep the trace but not the cancellation of the request
+			ctxCache := context.WithoutCancel(ctx)
 			go func() {
 				cacheDataBytes, errMarshal := json.Marshal(resp)
 				if errMarshal != nil {
 					logger.Error(ctx, utils.ErrorLogFormat, errMarshal.Error(), logCtx, "json.Marshal")
 				}
 				// Cache data for a reasonable amount of time (e.g., 1 hour)
-				errSetDataRedis := s.redis.Set(cacheKey, cacheDataBytes, time.Minute)
+				errSetDataRedis := s.redis.Set(ctxCache, cacheKey, cacheDataBytes, time.Duration(s.cacheTTL.Load()))
+				metrics.ObserveCacheWrite(metrics.CacheSet, errSetDataRedis)
 				if errSetDataRedis != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.Set")
+					logger.Error(ctx, utils.ErrorLogFormat, errSetDataRedis.Error(), logCtx, "s.redis.Set")
 				}
 				fmt.Printf("success SET on redis by key: %s\n", cacheKey)
 			}()
@@ -176,15 +224,21 @@ func (s Service) GetListArticle(ctx context.Context, param primitive.ParameterAr
 	return resp, count, nil
 }
 
-func (s Service) GetDetailArticle(ctx context.Context, articleID int64) (primitive.ArticleResp, error) {
+func (s Service) GetDetailArticle(ctx context.Context, articleID int64) (resp primitive.ArticleResp, err error) {
 	logCtx := fmt.Sprintf("service.GetDetailArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
 
-	var resp primitive.ArticleResp
 	cacheKey := fmt.Sprintf(redisFinaleKeyArticle, articleID)
 
 	// Check if the data exists in the Redis cache
 	if config.Conf.Redis.EnableRedis && s.redis != nil {
-		cacheData := s.redis.Get(cacheKey)
+		cacheData, errGetFromRedis := s.redis.Get(ctx, cacheKey)
+		metrics.ObserveCacheGet(cacheData != "", errGetFromRedis)
+		if errGetFromRedis != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errGetFromRedis.Error(), logCtx, "s.redis.Get")
+		}
+		logger.Debug(ctx, logCtx, "cache key %s, hit: %t", cacheKey, cacheData != "")
 		if cacheData != "" {
 			// If data exists in cache, decode it and return
 			err := json.Unmarshal([]byte(cacheData), &resp)
@@ -203,15 +257,18 @@ func (s Service) GetDetailArticle(ctx context.Context, articleID int64) (primiti
 
 	if config.Conf.Redis.EnableRedis && s.redis != nil {
 		if data.ID > 0 {
+			//the cache is written after the response, keep the trace but not the cancellation of the request
+			ctxCache := context.WithoutCancel(ctx)
 			go func() {
 				cacheDataBytes, errMarshal := json.Marshal(data)
 				if errMarshal != nil {
 					logger.Error(ctx, utils.ErrorLogFormat, errMarshal.Error(), logCtx, "json.Marshal")
 				}
 				// Cache data for a reasonable amount of time (e.g., 1 hour)
-				errSetDataRedis := s.redis.Set(cacheKey, cacheDataBytes, time.Minute)
+				errSetDataRedis := s.redis.Set(ctxCache, cacheKey, cacheDataBytes, time.Duration(s.cacheTTL.Load()))
+				metrics.ObserveCacheWrite(metrics.CacheSet, errSetDataRedis)
 				if errSetDataRedis != nil {
-					logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.redis.Set")
+					logger.Error(ctx, utils.ErrorLogFormat, errSetDataRedis.Error(), logCtx, "s.redis.Set")
 				}
 				fmt.Printf("success SET on redis by key: %s\n", cacheKey)
 			}()
@@ -231,22 +288,265 @@ func (s Service) GetDetailArticle(ctx context.Context, articleID int64) (primiti
 
 }
 
-func (s Service) RecordArticleToFile(ctx context.Context) {
+func (s Service) DeleteArticle(ctx context.Context, articleID int64) (err error) {
+	logCtx := fmt.Sprintf("service.DeleteArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
+
+	err = s.repository.DeleteArticle(ctx, articleID)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.DeleteArticle")
+		return err
+	}
+
+	//evict the detail and the lists from the cache, so it is not served after deletion
+	if config.Conf.Redis.EnableRedis && s.redis != nil {
+		cacheKey := fmt.Sprintf(redisFinaleKeyArticle, articleID)
+		errDelete := s.redis.DeleteKey(ctx, cacheKey)
+		metrics.ObserveCacheWrite(metrics.CacheDelete, errDelete)
+		if errDelete != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errDelete.Error(), logCtx, "s.redis.DeleteKey")
+		}
+		_, errDelete = s.redis.DeleteByPattern(ctx, redisListFinaleKeyArticle+"*")
+		metrics.ObserveCacheWrite(metrics.CacheDelete, errDelete)
+		if errDelete != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errDelete.Error(), logCtx, "s.redis.DeleteByPattern")
+		}
+	}
+
+	return nil
+}
+
+// ExportArticle stream every article ordered by id to w, the repository is read page by page
+// so the whole data set is never held in memory.
+func (s Service) ExportArticle(ctx context.Context, w io.Writer, format string) (total int, err error) {
+	logCtx := fmt.Sprintf("service.ExportArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
+
+	encoder, err := newArticleEncoder(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	paramQuery := primitive.ParameterFindArticle{
+		PageSize:  exportPageSize,
+		SortBy:    s.repository.SetParamQueryToOrderByQuery("id"),
+		SortOrder: "asc",
+	}
+
+	for {
+		listData, err := s.repository.FindListArticle(ctx, paramQuery)
+		if err != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.FindListArticle")
+			return total, err
+		}
+		for _, val := range listData {
+			err = encoder.Encode(primitive.ArticleResp{
+				ID:        val.ID,
+				Author:    val.Author,
+				Title:     val.Title,
+				Body:      val.Body,
+				CreatedAt: val.CreatedAt,
+				UpdatedAt: val.UpdatedAt,
+			})
+			if err != nil {
+				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "encoder.Encode")
+				return total, err
+			}
+			total++
+			if total%transferProgressEvery == 0 {
+				logger.Info(ctx, logCtx, "exported %d articles", total)
+			}
+		}
+		if len(listData) < paramQuery.PageSize {
+			break
+		}
+		paramQuery.Offset += paramQuery.PageSize
+	}
+
+	if err = encoder.Close(); err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "encoder.Close")
+		return total, err
+	}
+	logger.Info(ctx, logCtx, "finished export of %d articles as %s", total, format)
+	return total, nil
+}
+
+// ImportArticle read the articles from r and save them by batch, in upsert mode the ids
+// of the file are kept, in append mode every article get a new id.
+// Invalid records are skipped and reported, with DryRun nothing is saved.
+// The cached articles and lists are evicted once an article is imported.
+func (s Service) ImportArticle(ctx context.Context, r io.Reader, param primitive.ParameterImportArticle) (resp primitive.ImportArticleResp, err error) {
+	logCtx := fmt.Sprintf("service.ImportArticle")
+	ctx, span := tracing.Start(ctx, logCtx)
+	defer func() { tracing.End(span, err) }()
+
+	if param.Mode == "" {
+		param.Mode = ImportModeUpsert
+	}
+	if param.Mode != ImportModeUpsert && param.Mode != ImportModeAppend {
+		return primitive.ImportArticleResp{}, primitive.ErrorImportModeNotValid
+	}
+	if param.BatchSize <= 0 {
+		param.BatchSize = defaultImportBatchSize
+	}
+
+	resp = primitive.ImportArticleResp{
+		DryRun: param.DryRun,
+		Mode:   param.Mode,
+		Errors: make([]primitive.ImportArticleErrorResp, 0),
+	}
+
+	decoder, err := newArticleDecoder(r, param.Format)
+	if err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "newArticleDecoder")
+		return resp, err
+	}
+
+	//evict the details and the lists overwritten by the import, even when a later batch failed
+	defer func() {
+		if resp.Imported > 0 {
+			s.evictArticlesCache(ctx, logCtx)
+		}
+	}()
+
+	batch := make([]primitive.Article, 0, param.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 || param.DryRun {
+			batch = batch[:0]
+			return nil
+		}
+		if err := s.saveImportBatch(ctx, batch, param.Mode); err != nil {
+			return err
+		}
+		resp.Imported += len(batch)
+		logger.Info(ctx, logCtx, "imported %d articles", resp.Imported)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		resp.Total++
+
+		var invalidRecord errInvalidRecord
+		if errors.As(err, &invalidRecord) {
+			addImportError(&resp, resp.Total, invalidRecord.Error())
+			continue
+		}
+		if err != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "decoder.Decode")
+			return resp, err
+		}
+
+		errValidate := validator.ValidateStructResponseSliceString(primitive.ArticleReq{
+			Author: record.Author,
+			Title:  record.Title,
+			Body:   record.Body,
+		})
+		if errValidate != nil {
+			addImportError(&resp, resp.Total, strings.Join(errValidate, ", "))
+			continue
+		}
+		resp.Valid++
+
+		batch = append(batch, primitive.Article{
+			ID:        record.ID,
+			Author:    record.Author,
+			Title:     record.Title,
+			Body:      record.Body,
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: record.UpdatedAt,
+		})
+		if len(batch) >= param.BatchSize {
+			if err = flush(); err != nil {
+				logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.saveImportBatch")
+				return resp, err
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.saveImportBatch")
+		return resp, err
+	}
+
+	logger.Info(ctx, logCtx, "finished import of %d articles, valid: %d, invalid: %d, imported: %d",
+		resp.Total, resp.Valid, resp.Invalid, resp.Imported)
+	return resp, nil
+}
+
+// evictArticlesCache delete every article detail and list from the cache.
+func (s Service) evictArticlesCache(ctx context.Context, logCtx string) {
+	if !config.Conf.Redis.EnableRedis || s.redis == nil {
+		return
+	}
+	for _, pattern := range []string{redisPatternKeyArticle, redisListFinaleKeyArticle + "*"} {
+		_, errDelete := s.redis.DeleteByPattern(ctx, pattern)
+		metrics.ObserveCacheWrite(metrics.CacheDelete, errDelete)
+		if errDelete != nil {
+			logger.Error(ctx, utils.ErrorLogFormat, errDelete.Error(), logCtx, "s.redis.DeleteByPattern")
+		}
+	}
+}
+
+// saveImportBatch save the batch in one unit of work, a failing batch leave nothing behind.
+func (s Service) saveImportBatch(ctx context.Context, batch []primitive.Article, mode string) error {
+	if mode == ImportModeAppend {
+		_, err := s.repository.CreateArticles(ctx, batch)
+		return err
+	}
+
+	//a record without id can't be upserted, it is appended instead
+	var withID, withoutID []primitive.Article
+	for _, article := range batch {
+		if article.ID > 0 {
+			withID = append(withID, article)
+		} else {
+			withoutID = append(withoutID, article)
+		}
+	}
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repository.UpsertArticles(ctx, withID); err != nil {
+			return err
+		}
+		//the new ids, of this batch and the next creations, continue after the ids of the file
+		if len(withID) > 0 {
+			if err := s.repository.ResetIDSequence(ctx); err != nil {
+				return err
+			}
+		}
+		_, err := s.repository.CreateArticles(ctx, withoutID)
+		return err
+	})
+}
+
+func (s Service) RecordArticleToFile(ctx context.Context) error {
 	logCtx := fmt.Sprintf("service.RecordArticleToFile")
-	if !config.Conf.Postgres.EnablePostgres {
-		err := s.repository.SaveToFile("article.json")
+	if !config.Conf.DatabaseEnabled() {
+		err := s.repository.SaveToFile(config.Conf.InMemory.SnapshotPath)
 		if err != nil {
 			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.SaveToFile")
+			return err
 		}
 	}
+	return nil
 }
 
-func (s Service) LoadArticleToFile(ctx context.Context) {
+// LoadArticleToFile load the snapshot into the in-memory repository, the errors like a corrupted
+// write-ahead log are returned so the articles are not overwritten.
+func (s Service) LoadArticleToFile(ctx context.Context) error {
 	logCtx := fmt.Sprintf("service.LoadArticleToFile")
-	if !config.Conf.Postgres.EnablePostgres {
-		err := s.repository.LoadFromFile("article.json")
+	if !config.Conf.DatabaseEnabled() {
+		err := s.repository.LoadFromFile(config.Conf.InMemory.SnapshotPath)
 		if err != nil {
 			logger.Error(ctx, utils.ErrorLogFormat, err.Error(), logCtx, "s.repository.LoadFromFile")
+			return err
 		}
 	}
+	return nil
 }
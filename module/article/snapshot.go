@@ -0,0 +1,186 @@
+package article
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go-gin-gorm-example/module/primitive"
+)
+
+const (
+	// snapshotVersion is the version written in the header of every new snapshot,
+	// bump it and add a case in readSnapshot when the format change.
+	snapshotVersion = 1
+
+	snapshotBackupSeparator  = ".bak-"
+	snapshotBackupLayout     = "20060102T150405.000000000Z"
+	snapshotLockSuffix       = ".lock"
+	snapshotCorruptSeparator = ".corrupt-"
+)
+
+var errCorruptedSnapshot = errors.New("corrupted snapshot")
+
+// snapshotFile is the versioned content of a snapshot of the in-memory repository.
+type snapshotFile struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Articles  []primitive.Article `json:"articles"`
+}
+
+// writeSnapshot atomically replace path with the articles: the data is written and fsynced
+// into a temporary file of the same directory which is then renamed over path.
+// The previous snapshot is kept as a backup, only the last retention backups are kept.
+func writeSnapshot(path string, articles []primitive.Article, retention int) error {
+	if articles == nil {
+		articles = make([]primitive.Article, 0)
+	}
+	data, err := json.MarshalIndent(snapshotFile{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Articles:  articles,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		// no-op once renamed
+		_ = os.Remove(tmpPath)
+	}()
+
+	if err = tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if retention > 0 {
+		if err = backupSnapshot(path); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if err = syncDir(dir); err != nil {
+		return err
+	}
+
+	if retention > 0 {
+		return pruneSnapshotBackups(path, retention)
+	}
+	return nil
+}
+
+// readSnapshot read the articles of a snapshot, the legacy format without header
+// (a plain json array) is still accepted.
+func readSnapshot(path string) ([]primitive.Article, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return make([]primitive.Article, 0), nil
+	}
+
+	var articles []primitive.Article
+	if trimmed[0] == '[' {
+		if err = json.Unmarshal(trimmed, &articles); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", errCorruptedSnapshot, path, err)
+		}
+		return articles, nil
+	}
+
+	var snapshot snapshotFile
+	if err = json.Unmarshal(trimmed, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", errCorruptedSnapshot, path, err)
+	}
+	switch snapshot.Version {
+	case 1:
+		return snapshot.Articles, nil
+	default:
+		return nil, fmt.Errorf("snapshot %s has unsupported version %d", path, snapshot.Version)
+	}
+}
+
+// moveCorruptedSnapshot rename the snapshot under a timestamped name and return it.
+func moveCorruptedSnapshot(path string) (string, error) {
+	corruptPath := path + snapshotCorruptSeparator + time.Now().UTC().Format(snapshotBackupLayout)
+	if err := os.Rename(path, corruptPath); err != nil {
+		return "", err
+	}
+	return corruptPath, syncDir(filepath.Dir(path))
+}
+
+// backupSnapshot keep the current snapshot under a timestamped name, it is hard linked
+// so path stays in place until the new snapshot is renamed over it.
+func backupSnapshot(path string) error {
+	backupPath := path + snapshotBackupSeparator + time.Now().UTC().Format(snapshotBackupLayout)
+	err := os.Link(path, backupPath)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	// hard link is not supported everywhere, fallback to a copy
+	data, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return errRead
+	}
+	return os.WriteFile(backupPath, data, 0644)
+}
+
+func pruneSnapshotBackups(path string, retention int) error {
+	backups, err := filepath.Glob(path + snapshotBackupSeparator + "*")
+	if err != nil {
+		return err
+	}
+	if len(backups) <= retention {
+		return nil
+	}
+	// the timestamp layout sort lexicographically, oldest first
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-retention] {
+		if err = os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir fsync the directory so the rename survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err = d.Sync(); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package article
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-gin-gorm-example/module/primitive"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	ImportModeUpsert = "upsert"
+	ImportModeAppend = "append"
+
+	defaultImportBatchSize = 500
+	exportPageSize         = 500
+	transferProgressEvery  = 10000
+	maxImportErrorReported = 100
+)
+
+var csvHeader = []string{"id", "author", "title", "body", "createdAt", "updatedAt"}
+
+// errInvalidRecord is returned by a decoder when only the current record is malformed,
+// the import continues with the next one.
+type errInvalidRecord struct {
+	err error
+}
+
+func (e errInvalidRecord) Error() string {
+	return e.err.Error()
+}
+
+// addImportError count the invalid record, only the first ones are detailed in the report.
+func addImportError(resp *primitive.ImportArticleResp, record int, message string) {
+	resp.Invalid++
+	if len(resp.Errors) < maxImportErrorReported {
+		resp.Errors = append(resp.Errors, primitive.ImportArticleErrorResp{
+			Record:  record,
+			Message: message,
+		})
+	}
+}
+
+// FormatFromFileName guess the transfer format from the file extension, json by default.
+func FormatFromFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	case ".csv":
+		return FormatCSV
+	default:
+		return FormatJSON
+	}
+}
+
+// ContentType return the http content type of the transfer format.
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	default:
+		return "application/json"
+	}
+}
+
+type articleEncoder interface {
+	Encode(article primitive.ArticleResp) error
+	Close() error
+}
+
+type articleDecoder interface {
+	// Decode return io.EOF when there is no record left
+	Decode() (primitive.ArticleResp, error)
+}
+
+func newArticleEncoder(w io.Writer, format string) (articleEncoder, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonArticleEncoder{w: w}, nil
+	case FormatNDJSON:
+		return &ndjsonArticleEncoder{encoder: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvArticleEncoder{writer: writer}, nil
+	default:
+		return nil, primitive.ErrorFormatNotSupported
+	}
+}
+
+func newArticleDecoder(r io.Reader, format string) (articleDecoder, error) {
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(r)
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token != json.Delim('[') {
+			return nil, errors.New("json import must contain an array of articles")
+		}
+		return &jsonArticleDecoder{decoder: decoder}, nil
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		return &ndjsonArticleDecoder{scanner: scanner}, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.TrimSpace(name)] = i
+		}
+		return &csvArticleDecoder{reader: reader, columns: columns}, nil
+	default:
+		return nil, primitive.ErrorFormatNotSupported
+	}
+}
+
+type jsonArticleEncoder struct {
+	w       io.Writer
+	written int
+}
+
+func (e *jsonArticleEncoder) Encode(article primitive.ArticleResp) error {
+	data, err := json.Marshal(article)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if e.written == 0 {
+		separator = "["
+	}
+	if _, err = io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	e.written++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonArticleEncoder) Close() error {
+	closing := "]\n"
+	if e.written == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+type ndjsonArticleEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonArticleEncoder) Encode(article primitive.ArticleResp) error {
+	return e.encoder.Encode(article)
+}
+
+func (e *ndjsonArticleEncoder) Close() error {
+	return nil
+}
+
+type csvArticleEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvArticleEncoder) Encode(article primitive.ArticleResp) error {
+	return e.writer.Write([]string{
+		strconv.FormatInt(article.ID, 10),
+		article.Author,
+		article.Title,
+		article.Body,
+		article.CreatedAt.Format(time.RFC3339Nano),
+		article.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvArticleEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonArticleDecoder struct {
+	decoder *json.Decoder
+}
+
+func (d *jsonArticleDecoder) Decode() (primitive.ArticleResp, error) {
+	var article primitive.ArticleResp
+	if !d.decoder.More() {
+		return article, io.EOF
+	}
+	err := d.decoder.Decode(&article)
+	return article, err
+}
+
+type ndjsonArticleDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func (d *ndjsonArticleDecoder) Decode() (primitive.ArticleResp, error) {
+	var article primitive.ArticleResp
+	for d.scanner.Scan() {
+		line := strings.TrimSpace(d.scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(line), &article); err != nil {
+			return article, errInvalidRecord{err: err}
+		}
+		return article, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return article, err
+	}
+	return article, io.EOF
+}
+
+type csvArticleDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func (d *csvArticleDecoder) Decode() (primitive.ArticleResp, error) {
+	var article primitive.ArticleResp
+	record, err := d.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return article, errInvalidRecord{err: err}
+		}
+		return article, err
+	}
+
+	article.Author = d.column(record, "author")
+	article.Title = d.column(record, "title")
+	article.Body = d.column(record, "body")
+
+	if id := d.column(record, "id"); id != "" {
+		if article.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return article, errInvalidRecord{err: fmt.Errorf("invalid id %q", id)}
+		}
+	}
+	if createdAt := d.column(record, "createdAt"); createdAt != "" {
+		if article.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return article, errInvalidRecord{err: fmt.Errorf("invalid createdAt %q", createdAt)}
+		}
+	}
+	if updatedAt := d.column(record, "updatedAt"); updatedAt != "" {
+		if article.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+			return article, errInvalidRecord{err: fmt.Errorf("invalid updatedAt %q", updatedAt)}
+		}
+	}
+	return article, nil
+}
+
+func (d *csvArticleDecoder) column(record []string, name string) string {
+	i, ok := d.columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
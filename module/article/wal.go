@@ -0,0 +1,298 @@
+package article
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go-gin-gorm-example/module/primitive"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	WALSyncAlways   = "always"
+	WALSyncInterval = "interval"
+	WALSyncNever    = "never"
+
+	walOpPut    = "put"
+	walOpRemove = "remove"
+
+	// every record is framed as [4 bytes length][4 bytes crc32 of the payload][payload]
+	walHeaderSize       = 8
+	walMaxRecordSize    = 64 * 1024 * 1024
+	defaultSyncInterval = time.Second
+)
+
+var (
+	errTornWALRecord = errors.New("torn write-ahead log record")
+	// ErrCorruptedWAL is returned by the replay of a write-ahead log with a corrupted record before its tail,
+	// the records after it are not dropped, the log is left as is for a manual repair
+	ErrCorruptedWAL = errors.New("corrupted write-ahead log")
+	// ErrFileLocked is returned when the write-ahead log or the snapshot is used by another process,
+	// like a command run while the server is up
+	ErrFileLocked = errors.New("locked by another process")
+)
+
+// walRecord is one mutation of the in-memory repository, a put record carries
+// the full state of the articles after the mutation so replaying it is idempotent,
+// a remove record drop the articles created by a rolled back unit of work.
+type walRecord struct {
+	Op       string              `json:"op"`
+	Articles []primitive.Article `json:"articles"`
+}
+
+// writeAheadLog is an append-only file of walRecord.
+type writeAheadLog struct {
+	mu         sync.Mutex
+	file       *os.File
+	path       string
+	syncPolicy string
+	size       int64
+	dirty      bool
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func openWriteAheadLog(path string, syncPolicy string, syncInterval time.Duration) (*writeAheadLog, error) {
+	switch syncPolicy {
+	case "":
+		syncPolicy = WALSyncAlways
+	case WALSyncAlways, WALSyncInterval, WALSyncNever:
+	default:
+		return nil, fmt.Errorf("unknown write-ahead log sync policy %q, use one of always|interval|never", syncPolicy)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	//two processes appending at their own size would interleave the records
+	if err = lockFile(file); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("write-ahead log %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	wal := &writeAheadLog{
+		file:       file,
+		path:       path,
+		syncPolicy: syncPolicy,
+		size:       info.Size(),
+		stop:       make(chan struct{}),
+	}
+
+	if syncPolicy == WALSyncInterval {
+		if syncInterval <= 0 {
+			syncInterval = defaultSyncInterval
+		}
+		go wal.syncEvery(syncInterval)
+	}
+
+	return wal, nil
+}
+
+// Append write the record at the end of the log and sync it according to the policy.
+func (w *writeAheadLog) Append(record walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[walHeaderSize:], payload)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err = w.file.WriteAt(frame, w.size); err != nil {
+		return err
+	}
+	w.size += int64(len(frame))
+
+	if w.syncPolicy == WALSyncAlways {
+		return w.file.Sync()
+	}
+	w.dirty = true
+	return nil
+}
+
+// Replay call fn for every complete record from the start of the log. A torn or corrupted
+// record at the tail (crash in the middle of a write) ends the replay and is cut off the file,
+// a corrupted record followed by valid ones fails the replay with ErrCorruptedWAL.
+func (w *writeAheadLog) Replay(fn func(record walRecord)) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	reader := bufio.NewReader(io.NewSectionReader(w.file, 0, w.size))
+	var offset int64
+	var replayed int
+	for {
+		record, n, err := readWALRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return replayed, nil
+		}
+		if errors.Is(err, errTornWALRecord) {
+			dropped, err := w.recordsAfter(offset)
+			if err != nil {
+				return replayed, err
+			}
+			if dropped > 0 {
+				return replayed, fmt.Errorf("%w %s: record at offset %d, %d records and %d bytes after it are not replayed",
+					ErrCorruptedWAL, w.path, offset, dropped, w.size-offset)
+			}
+			log.Warnf("write-ahead log %s has a torn record at offset %d, truncating it", w.path, offset)
+			if err = w.file.Truncate(offset); err != nil {
+				return replayed, err
+			}
+			w.size = offset
+			return replayed, w.file.Sync()
+		}
+		if err != nil {
+			return replayed, err
+		}
+		fn(record)
+		offset += n
+		replayed++
+	}
+}
+
+// recordsAfter count the valid records following the bad one at offset. A torn write is the last one,
+// so a valid record after it means the log is corrupted: every position is tried as the start of a
+// record since the length of the bad one can't be trusted, then the records are read from the first found.
+func (w *writeAheadLog) recordsAfter(offset int64) (int, error) {
+	rest := make([]byte, w.size-offset)
+	if _, err := w.file.ReadAt(rest, offset); err != nil {
+		return 0, err
+	}
+	for start := 1; start < len(rest); start++ {
+		if _, ok := checkWALFrame(rest[start:]); !ok {
+			continue
+		}
+		count := 0
+		for size, ok := checkWALFrame(rest[start:]); ok; size, ok = checkWALFrame(rest[start:]) {
+			start += size
+			count++
+		}
+		return count, nil
+	}
+	return 0, nil
+}
+
+// checkWALFrame tell if data start with a complete record and return its size.
+func checkWALFrame(data []byte) (int, bool) {
+	if len(data) < walHeaderSize {
+		return 0, false
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length == 0 || length > walMaxRecordSize || int(length) > len(data)-walHeaderSize {
+		return 0, false
+	}
+	payload := data[walHeaderSize : walHeaderSize+int(length)]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) || !json.Valid(payload) {
+		return 0, false
+	}
+	return walHeaderSize + int(length), true
+}
+
+// Reset empty the log, called once its records are part of a snapshot.
+func (w *writeAheadLog) Reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// Size return the current size of the log in bytes.
+func (w *writeAheadLog) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size
+}
+
+func (w *writeAheadLog) Close() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *writeAheadLog) syncEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty {
+				if err := w.file.Sync(); err != nil {
+					log.Errorf("failed sync write-ahead log %s: %v", w.path, err)
+				} else {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// readWALRecord read one framed record, returning the number of bytes consumed.
+func readWALRecord(reader io.Reader) (walRecord, int64, error) {
+	var record walRecord
+
+	header := make([]byte, walHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	if errors.Is(err, io.EOF) {
+		return record, 0, io.EOF
+	}
+	if err != nil || n < walHeaderSize {
+		return record, 0, errTornWALRecord
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length == 0 || length > walMaxRecordSize {
+		return record, 0, errTornWALRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return record, 0, errTornWALRecord
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return record, 0, errTornWALRecord
+	}
+	if err = json.Unmarshal(payload, &record); err != nil {
+		return record, 0, errTornWALRecord
+	}
+
+	return record, int64(walHeaderSize + length), nil
+}
@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/infrastructure/breaker"
+	"go-gin-gorm-example/infrastructure/database"
+	"go-gin-gorm-example/infrastructure/limiter"
+	"go-gin-gorm-example/infrastructure/retry"
+
+	"github.com/go-redis/redis"
+)
+
+// Checker check one dependency of the service, it is the checker the modules append to their context.
+type Checker = boot.HealthChecker
+
+type checker struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+// NewChecker build a Checker calling check.
+func NewChecker(name string, critical bool, check func(ctx context.Context) error) Checker {
+	return &checker{
+		name:     name,
+		critical: critical,
+		check:    check,
+	}
+}
+
+func (c *checker) Name() string {
+	return c.name
+}
+
+func (c *checker) Critical() bool {
+	return c.critical
+}
+
+func (c *checker) Check(ctx context.Context) error {
+	return c.check(ctx)
+}
+
+// NewDatabaseChecker ping the database, it is critical: the articles can't be served without it.
+func NewDatabaseChecker(repository RepositoryInterface, state *retry.State) Checker {
+	return NewChecker("database", true, func(ctx context.Context) error {
+		if err := stateError(state); err != nil {
+			return err
+		}
+		return repository.CheckUpTimeDB(ctx)
+	})
+}
+
+// NewReplicaChecker report the read replicas which are ejected, the reads fall back on the primary.
+func NewReplicaChecker(replicas *database.ReplicaSet) Checker {
+	return NewChecker("database.replicas", false, func(ctx context.Context) error {
+		var ejected []string
+		for _, status := range replicas.Status() {
+			if !status.Healthy {
+				ejected = append(ejected, fmt.Sprintf("%s: %s", status.Name, status.LastError))
+			}
+		}
+		if len(ejected) > 0 {
+			return fmt.Errorf("ejected replicas: %s", strings.Join(ejected, ", "))
+		}
+		return nil
+	})
+}
+
+// NewRedisChecker ping redis, the cache is optional so it is not critical.
+func NewRedisChecker(redisClient *redis.Client, state *retry.State) Checker {
+	return NewChecker("redis", false, func(ctx context.Context) error {
+		if err := stateError(state); err != nil {
+			return err
+		}
+		return redisClient.WithContext(ctx).Ping().Err()
+	})
+}
+
+// NewBreakerChecker report a circuit breaker which is not closed.
+func NewBreakerChecker(b *breaker.Breaker) Checker {
+	return NewChecker("circuitBreaker."+b.Name(), false, func(ctx context.Context) error {
+		if state := b.State(); state != breaker.StateClosed {
+			return fmt.Errorf("circuit breaker is %s", state)
+		}
+		return nil
+	})
+}
+
+// NewSnapshotChecker check a snapshot of the in-memory repository can be written at path,
+// the articles are still served when it can't but the changes are lost on restart.
+func NewSnapshotChecker(path string) Checker {
+	return NewChecker("inMemory.snapshot", false, func(ctx context.Context) error {
+		// the snapshot is written to a temporary file of its directory then renamed
+		tmp, err := os.CreateTemp(filepath.Dir(path), ".health-*")
+		if err != nil {
+			return fmt.Errorf("snapshot directory is not writable: %w", err)
+		}
+		errClose := tmp.Close()
+		errRemove := os.Remove(tmp.Name())
+		return errors.Join(errClose, errRemove)
+	})
+}
+
+// NewLimiterChecker report a rate limiter rejecting every request or not refilled anymore.
+func NewLimiterChecker(rateLimiter *limiter.RateLimiter) Checker {
+	return NewChecker("rateLimiter", false, func(ctx context.Context) error {
+		return rateLimiter.Check()
+	})
+}
+
+// stateError return the error of a dependency reconnecting in the background.
+func stateError(state *retry.State) error {
+	if state.Ready() {
+		return nil
+	}
+	if err := state.Err(); err != nil {
+		return fmt.Errorf("reconnecting: %w", err)
+	}
+	return errors.New("reconnecting")
+}
@@ -28,29 +28,59 @@ type InterfaceHttp interface {
 
 func (h *Http) GroupHealth(g *gin.RouterGroup) {
 	g.GET("/ping", h.Ping)
-	g.GET("/check", h.HealthCheckApi)
+	g.GET("/live", h.Live)
+	g.GET("/ready", h.Ready)
+	g.GET("/details", h.Details)
+	//kept for the clients of the former health check
+	g.GET("/check", h.Details)
 }
 
 func (h *Http) Ping(c *gin.Context) {
 	httplib.SetSuccessResponse(c, http.StatusOK, http.StatusText(http.StatusOK), "pong")
 }
 
-func (h *Http) HealthCheckApi(c *gin.Context) {
-	logCtx := "handler.HealthCheckApi"
+// Live answer 200 as long as the process serve requests, for the liveness probe.
+func (h *Http) Live(c *gin.Context) {
+	if !h.checkService(c, "handler.Live") {
+		return
+	}
+	httplib.SetSuccessResponse(c, http.StatusOK, http.StatusText(http.StatusOK), h.serviceHealth.Live(c))
+}
 
-	if h.serviceHealth == nil {
-		err := errors.New("dependency service health to handler health is nil")
-		logger.Error(c, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
-		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+// Ready answer 503 while a critical dependency is down, for the readiness probe.
+func (h *Http) Ready(c *gin.Context) {
+	if !h.checkService(c, "handler.Ready") {
 		return
 	}
 
-	resp, err := h.serviceHealth.CheckUpTime(c)
-	if err != nil {
-		logger.Error(c, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth.CheckUpTime")
-		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+	resp, err := h.serviceHealth.Ready(c)
+	if errors.Is(err, primitive.ErrorServiceNotReady) {
+		httplib.SetSuccessResponse(c, http.StatusServiceUnavailable, primitive.ServiceIsNotReady, resp)
 		return
 	}
 	httplib.SetSuccessResponse(c, http.StatusOK, http.StatusText(http.StatusOK), resp)
-	return
+}
+
+// Details answer the status of every dependency, 503 while a critical one is down.
+func (h *Http) Details(c *gin.Context) {
+	if !h.checkService(c, "handler.Details") {
+		return
+	}
+
+	resp := h.serviceHealth.Details(c)
+	if resp.Status == StatusDown {
+		httplib.SetSuccessResponse(c, http.StatusServiceUnavailable, primitive.ServiceIsNotReady, resp)
+		return
+	}
+	httplib.SetSuccessResponse(c, http.StatusOK, http.StatusText(http.StatusOK), resp)
+}
+
+func (h *Http) checkService(c *gin.Context, logCtx string) bool {
+	if h.serviceHealth == nil {
+		err := errors.New("dependency service health to handler health is nil")
+		logger.Error(c, utils.ErrorLogFormat, err.Error(), logCtx, "h.serviceHealth")
+		httplib.SetErrorResponse(c, http.StatusInternalServerError, primitive.SomethingWentWrong)
+		return false
+	}
+	return true
 }
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"go-gin-gorm-example/boot"
+	"go-gin-gorm-example/infrastructure/config"
+)
+
+// the health module serve the probes on /api/v1/health, they are not rate limited
+func init() {
+	boot.RegisterModule(module())
+}
+
+// module check the infrastructure and the checkers appended by the other modules.
+func module() boot.Module {
+	var moduleCtx *boot.ModuleContext
+	var checkers []Checker
+	return boot.Module{
+		Name: "health",
+		Setup: func(ctx *boot.ModuleContext) error {
+			moduleCtx = ctx
+			checkers = makeCheckers(ctx)
+			return nil
+		},
+		Routes: func(routes boot.Routes) {
+			//the checkers of every module are known once they are all set up
+			healthService := NewService(append(checkers, moduleCtx.HealthCheckers...)...)
+			NewHttp(healthService).GroupHealth(routes.Root.Group("/api/v1/health"))
+		},
+	}
+}
+
+// makeCheckers return the checkers of the infrastructure enabled in the config and of the limiter.
+func makeCheckers(ctx *boot.ModuleContext) []Checker {
+	var checkers []Checker
+	if config.Conf.DatabaseEnabled() {
+		checkers = append(checkers, NewDatabaseChecker(NewRepository(ctx.DB.DbConn), ctx.DB.State))
+		if ctx.DB.Replicas != nil {
+			checkers = append(checkers, NewReplicaChecker(ctx.DB.Replicas))
+		}
+	}
+	if config.Conf.Redis.EnableRedis {
+		checkers = append(checkers, NewRedisChecker(ctx.RedisClient, ctx.RedisState))
+	}
+	for _, b := range ctx.Breakers {
+		checkers = append(checkers, NewBreakerChecker(b))
+	}
+	return append(checkers, NewLimiterChecker(ctx.Limiter))
+}
@@ -22,13 +22,13 @@ func NewRepository(db *gorm.DB) *Repository {
 }
 
 func (r Repository) CheckUpTimeDB(ctx context.Context) (err error) {
-	if config.Conf.Postgres.EnablePostgres {
+	if config.Conf.DatabaseEnabled() {
 		db, err := r.db.WithContext(ctx).DB()
 		if err != nil {
 			return err
 		}
 
-		err = db.Ping()
+		err = db.PingContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -2,65 +2,141 @@ package health
 
 import (
 	"context"
-	"errors"
+	"sync"
+	"time"
 
-	"go-gin-gorm-example/infrastructure/config"
 	logger "go-gin-gorm-example/infrastructure/log"
 	"go-gin-gorm-example/module/primitive"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
 
-	"github.com/go-redis/redis"
+	// checkTimeout bound every check, so a hanging dependency doesn't hang the probes
+	checkTimeout = 2 * time.Second
 )
 
 type InterfaceService interface {
-	CheckUpTime(ctx context.Context) (resp primitive.HealthResp, err error)
+	Live(ctx context.Context) primitive.HealthLiveResp
+	Ready(ctx context.Context) (primitive.HealthDetailsResp, error)
+	Details(ctx context.Context) primitive.HealthDetailsResp
+}
+
+type lastError struct {
+	message string
+	at      time.Time
 }
 
 type Service struct {
-	repository  RepositoryInterface
-	redisClient *redis.Client
+	checkers  []Checker
+	startedAt time.Time
+
+	mu         sync.Mutex
+	lastErrors map[string]lastError
 }
 
-func NewService(repository RepositoryInterface, redisClient *redis.Client) InterfaceService {
+// NewService check the dependencies of checkers, they are run concurrently on every request.
+func NewService(checkers ...Checker) InterfaceService {
 	return &Service{
-		repository:  repository,
-		redisClient: redisClient,
+		checkers:   checkers,
+		startedAt:  time.Now(),
+		lastErrors: make(map[string]lastError),
 	}
 }
 
-func (u *Service) CheckUpTime(ctx context.Context) (primitive.HealthResp, error) {
-	ctxName := "CheckUpTime"
+// Live return up as long as the process serve requests, no dependency is checked.
+func (u *Service) Live(ctx context.Context) primitive.HealthLiveResp {
+	return primitive.HealthLiveResp{
+		Status: StatusUp,
+		Uptime: time.Since(u.startedAt).Round(time.Second).String(),
+	}
+}
 
-	var postgresStatus string
-	if config.Conf.Postgres.EnablePostgres {
-		if u.repository == nil {
-			err := errors.New("repository doesn't initiate on the boot file")
-			return primitive.HealthResp{}, err
+// Ready check the critical dependencies, it return primitive.ErrorServiceNotReady when one of them is down.
+func (u *Service) Ready(ctx context.Context) (primitive.HealthDetailsResp, error) {
+	var critical []Checker
+	for _, c := range u.checkers {
+		if c.Critical() {
+			critical = append(critical, c)
 		}
+	}
 
-		errCheckDb := u.repository.CheckUpTimeDB(ctx)
-		if errCheckDb != nil {
-			logger.Error(ctx, ctxName, "got error when %s : %v", ctxName, errCheckDb)
-			return primitive.HealthResp{}, errCheckDb
-		}
-		postgresStatus = "healthy"
-	} else {
-		postgresStatus = "postgres is not enabled"
+	resp := u.run(ctx, critical)
+	if resp.Status == StatusDown {
+		return resp, primitive.ErrorServiceNotReady
+	}
+	return resp, nil
+}
+
+// Details check every dependency, the status is down when a critical dependency is down
+// and degraded when only non-critical ones are.
+func (u *Service) Details(ctx context.Context) primitive.HealthDetailsResp {
+	return u.run(ctx, u.checkers)
+}
+
+func (u *Service) run(ctx context.Context, checkers []Checker) primitive.HealthDetailsResp {
+	ctxName := "health.Service.run"
+
+	checks := make([]primitive.HealthCheckResp, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func(i int, c Checker) {
+			defer wg.Done()
+
+			ctxCheck, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := c.Check(ctxCheck)
+			latency := time.Since(start)
+
+			check := primitive.HealthCheckResp{
+				Name:     c.Name(),
+				Status:   StatusUp,
+				Critical: c.Critical(),
+				Latency:  latency.String(),
+			}
+			if err != nil {
+				logger.Error(ctx, ctxName, "check %s got error : %v", c.Name(), err)
+				check.Status = StatusDown
+			}
+			check.LastError, check.LastErrorAt = u.recordError(c.Name(), err)
+			checks[i] = check
+		}(i, c)
 	}
+	wg.Wait()
 
-	var redisStatus string
-	if config.Conf.Redis.EnableRedis && u.redisClient != nil {
-		errCheckRedis := u.redisClient.Ping().Err()
-		if errCheckRedis != nil {
-			logger.Error(ctx, ctxName, "got error when %s : %v", ctxName, errCheckRedis)
-			return primitive.HealthResp{}, errCheckRedis
+	status := StatusUp
+	for _, check := range checks {
+		if check.Status != StatusDown {
+			continue
+		}
+		if check.Critical {
+			status = StatusDown
+			break
 		}
-		redisStatus = "healthy"
-	} else {
-		redisStatus = "not initiated"
+		status = StatusDegraded
 	}
 
-	return primitive.HealthResp{
-		Db:    postgresStatus,
-		Redis: redisStatus,
-	}, nil
+	return primitive.HealthDetailsResp{
+		Status: status,
+		Checks: checks,
+	}
+}
+
+// recordError remember the error of the check name and return the last one it had, even if it recovered since.
+func (u *Service) recordError(name string, err error) (string, *time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err != nil {
+		u.lastErrors[name] = lastError{message: err.Error(), at: time.Now()}
+	}
+	last, ok := u.lastErrors[name]
+	if !ok {
+		return "", nil
+	}
+	return last.message, &last.at
 }
@@ -5,6 +5,8 @@ import "errors"
 const (
 	SuccessCreateArticle             = "success record article"
 	SuccessGetArticle                = "success get record article"
+	SuccessImportArticle             = "success import article"
+	SuccessDryRunArticle             = "success validate import article"
 	ParamIdIsZeroOrNullString        = "param id given value is either zero or empty"
 	RecordArticleNotFound            = "record data article not found"
 	QueryIsSuspicious                = "the query parameter given value is suspicious"
@@ -12,6 +14,17 @@ const (
 	SomethingWrongWithTheBodyRequest = "oops, something wrong with body request, please recheck!"
 	SomethingWentWrong               = "oops, something went wrong!"
 	ErrArticleNotFound               = "article not found"
+	FormatIsNotSupported             = "format is not supported, use one of json|ndjson|csv"
+	ImportModeIsNotValid             = "import mode is not valid, use one of upsert|append"
+	ServiceIsNotReady                = "service is not ready, a critical dependency is down"
+	ServiceIsUnavailable             = "service is temporarily unavailable, please retry later"
+	SuccessUpdateLogLevels           = "success update log levels"
+	DebugWindowIsNotValid            = "debug window duration is not valid or longer than the maximum allowed"
 )
 
-var ErrorArticleNotFound = errors.New(ErrArticleNotFound)
+var (
+	ErrorArticleNotFound    = errors.New(ErrArticleNotFound)
+	ErrorFormatNotSupported = errors.New(FormatIsNotSupported)
+	ErrorImportModeNotValid = errors.New(ImportModeIsNotValid)
+	ErrorServiceNotReady    = errors.New(ServiceIsNotReady)
+)
@@ -19,9 +19,18 @@ type ParameterFindArticle struct {
 	Offset    int
 	SortBy    string
 	SortOrder string
+	// WithDeleted include the soft deleted articles, like for the copy between backends
+	WithDeleted bool
 }
 
 type ParameterArticleHandler struct {
 	Query  string
 	Author string
 }
+
+type ParameterImportArticle struct {
+	Format    string
+	Mode      string
+	DryRun    bool
+	BatchSize int
+}
@@ -5,3 +5,19 @@ type ArticleReq struct {
 	Title  string `json:"title" validate:"required"`
 	Body   string `json:"body" validate:"required"`
 }
+
+// LogLevelsReq replace the base log level and the levels by context.
+type LogLevelsReq struct {
+	Level     string            `json:"level" validate:"required"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// LogLevelReq set the log level of a context.
+type LogLevelReq struct {
+	Level string `json:"level" validate:"required"`
+}
+
+// DebugWindowReq log every context at debug level for Duration, like "15m", zero end the running window.
+type DebugWindowReq struct {
+	Duration string `json:"duration" validate:"required"`
+}
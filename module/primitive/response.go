@@ -11,7 +11,39 @@ type ArticleResp struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-type HealthResp struct {
-	Db    string `json:"db"`
-	Redis string `json:"redis"`
+// HealthLiveResp is the liveness of the process.
+type HealthLiveResp struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+}
+
+// HealthDetailsResp is the status of the service, up|degraded|down, and of each dependency.
+type HealthDetailsResp struct {
+	Status string            `json:"status"`
+	Checks []HealthCheckResp `json:"checks"`
+}
+
+// HealthCheckResp is the status of a dependency, up|down, LastError is kept after it recovered.
+type HealthCheckResp struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	Latency     string     `json:"latency"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type ImportArticleResp struct {
+	DryRun   bool                     `json:"dryRun"`
+	Mode     string                   `json:"mode"`
+	Total    int                      `json:"total"`
+	Valid    int                      `json:"valid"`
+	Invalid  int                      `json:"invalid"`
+	Imported int                      `json:"imported"`
+	Errors   []ImportArticleErrorResp `json:"errors"`
+}
+
+type ImportArticleErrorResp struct {
+	Record  int    `json:"record"`
+	Message string `json:"message"`
 }
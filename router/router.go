@@ -7,6 +7,7 @@ import (
 
 	"go-gin-gorm-example/boot"
 	"go-gin-gorm-example/infrastructure/httplib"
+	"go-gin-gorm-example/infrastructure/metrics"
 	"go-gin-gorm-example/infrastructure/middleware"
 )
 
@@ -41,12 +42,29 @@ func (hr *HandlerRouter) RouterWithMiddleware() *gin.Engine {
 	//and method with not allowed handler
 	c := gin.New()
 
+	//log the requests, with a correlation id, before the other middlewares to measure them,
+	//and before the recovery so the panics answered with a 500 are logged too
+	if config.Conf.AccessLog.EnableAccessLog {
+		accessLog := middleware.NewAccessLog(config.Conf.AccessLog)
+		config.Subscribe("access log", func(conf config.Config) error {
+			accessLog.Update(conf.AccessLog)
+			return nil
+		}, "accessLog")
+		c.Use(accessLog.Middleware())
+	}
+
 	//use recovery
 	c.Use(gin.Recovery())
 
-	//if logMode is true set logger to stdout on gin
-	if config.Conf.LogMode {
-		c.Use(gin.Logger())
+	//start a span for every request, following the traceparent of the caller
+	if config.Conf.Tracing.EnableTracing {
+		c.Use(middleware.TracingMiddleware())
+	}
+
+	//count the requests and expose the prometheus metrics, not rate limited
+	if config.Conf.Metrics.EnableMetrics {
+		c.Use(middleware.MetricsMiddleware())
+		c.GET(config.Conf.Metrics.Path, gin.WrapH(metrics.Handler()))
 	}
 
 	//set middleware to use not found handler
@@ -60,16 +78,24 @@ func (hr *HandlerRouter) RouterWithMiddleware() *gin.Engine {
 
 	api.Use(middleware.RateLimiterMiddleware(hr.Setup.Limiter))
 
+	//read from the primary for a while after a write when reads go to the replicas
+	if config.Conf.DatabaseDriver() == config.DriverPostgres && len(config.Conf.Postgres.Replica.Hosts) > 0 {
+		api.Use(middleware.ReadYourWritesMiddleware(config.Conf.Postgres.Replica.Stickiness))
+	}
+
 	//grouping on "api/v1"
 	v1 := api.Group("/v1")
 
-	//module health
-	prefixHealth := v1.Group("/health")
-	hr.Setup.HealthHttp.GroupHealth(prefixHealth)
-
-	//module article
-	prefixArticle := v1.Group("/articles")
-	hr.Setup.ArticleHttp.GroupArticle(prefixArticle)
+	//mount the routes of every module enabled
+	routes := boot.Routes{
+		Root: &c.RouterGroup,
+		V1:   v1,
+	}
+	for _, module := range hr.Setup.Modules {
+		if module.Routes != nil {
+			module.Routes(routes)
+		}
+	}
 
 	return c
 